@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"gopkg.in/yaml.v2"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type AlertOptions struct {
+	Config string `long:"config" short:"c" required:"true" description:"YAML file listing the servers to poll and the rules to evaluate."`
+	Once   bool   `long:"once" default:"false" description:"Poll once and exit instead of polling forever."`
+}
+
+var alertOptions AlertOptions
+
+// AlertConfig is the --config file.
+type AlertConfig struct {
+	Interval uint        `yaml:"interval"`
+	Timeout  uint        `yaml:"timeout"`
+	Servers  []string    `yaml:"servers"`
+	Rules    []AlertRule `yaml:"rules"`
+}
+
+// AlertRule fires when its condition has held for Polls consecutive polls
+// of a server, and notifies again once it stops holding.
+type AlertRule struct {
+	Name       string   `yaml:"name"`
+	When       string   `yaml:"when"`
+	Polls      int      `yaml:"polls"`
+	Webhook    string   `yaml:"webhook"`
+	Command    string   `yaml:"command"`
+	Servers    []string `yaml:"servers"`
+	NoRecovery bool     `yaml:"no_recovery"`
+
+	cond alertCondition
+}
+
+const (
+	alertDown    = "down"
+	alertCompare = "compare"
+	alertChanged = "changed"
+)
+
+type alertCondition struct {
+	kind  string
+	field string
+	op    string
+	value int
+}
+
+// Alert is the JSON body posted to webhooks and fed to commands.
+type Alert struct {
+	Rule      string
+	Condition string
+	State     string // firing, resolved or changed
+	Server    string
+	Name      string `json:",omitempty"`
+	Value     string `json:",omitempty"`
+	Previous  string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	Time      time.Time
+}
+
+type alertState struct {
+	streak int
+	firing bool
+	last   string
+	seen   bool
+}
+
+type alerter struct {
+	config  *AlertConfig
+	states  map[string]*alertState
+	notify  func(rule *AlertRule, alert Alert)
+	pending []pendingAlert
+}
+
+// pendingAlert is an alert fired during a poll and not yet delivered.
+type pendingAlert struct {
+	rule  *AlertRule
+	alert Alert
+}
+
+// Webhooks and commands get this long before they're given up on, so a
+// slow one can't hold up polling for long.
+const alertNotifyTimeout = 10 * time.Second
+
+var (
+	_alertcompareregexp = regexp.MustCompile(`^([a-z]+)\s*(>=|<=|==|!=|>|<)\s*(-?\d+)$`)
+	_alertchangedregexp = regexp.MustCompile(`^([a-z]+)\s+changed$`)
+)
+
+func alertctx() {
+	log.SetFlags(log.LstdFlags)
+
+	config, err := loadAlertConfig(alertOptions.Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a := newAlerter(config)
+	a.notify = sendAlert
+
+	interval := time.Duration(config.Interval) * time.Second
+	timeout := time.Duration(config.Timeout) * time.Second
+
+	for {
+		a.poll(timeout)
+		if alertOptions.Once {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func loadAlertConfig(path string) (*AlertConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &AlertConfig{Interval: 30, Timeout: 2}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("Couldn't read %s: %s", path, err)
+	}
+
+	if len(config.Servers) == 0 {
+		return nil, fmt.Errorf("%s lists no servers.", path)
+	}
+	if len(config.Rules) == 0 {
+		return nil, fmt.Errorf("%s lists no rules.", path)
+	}
+	if config.Interval == 0 {
+		config.Interval = 1
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			rule.Name = rule.When
+		}
+		if rule.Polls < 1 {
+			rule.Polls = 1
+		}
+		if rule.cond, err = parseAlertCondition(rule.When); err != nil {
+			return nil, fmt.Errorf("Rule '%s': %s", rule.Name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// parseAlertCondition reads a rule's when: "down", "FIELD OP NUMBER" such
+// as "players > 20", or "FIELD changed" such as "map changed".
+func parseAlertCondition(when string) (alertCondition, error) {
+	if when == alertDown {
+		return alertCondition{kind: alertDown}, nil
+	}
+
+	if match := _alertcompareregexp.FindStringSubmatch(when); match != nil {
+		if _, err := query.ParseFields(match[1]); err != nil {
+			return alertCondition{}, err
+		}
+		value, _ := strconv.Atoi(match[3])
+		return alertCondition{kind: alertCompare, field: match[1], op: match[2], value: value}, nil
+	}
+
+	if match := _alertchangedregexp.FindStringSubmatch(when); match != nil {
+		if _, err := query.ParseFields(match[1]); err != nil {
+			return alertCondition{}, err
+		}
+		return alertCondition{kind: alertChanged, field: match[1]}, nil
+	}
+
+	return alertCondition{}, fmt.Errorf("Couldn't parse condition '%s'. "+
+		"Use 'down', 'FIELD > N' or 'FIELD changed'.", when)
+}
+
+func newAlerter(config *AlertConfig) *alerter {
+	return &alerter{
+		config: config,
+		states: make(map[string]*alertState),
+	}
+}
+
+// poll queries every server once and evaluates the rules against them.
+func (a *alerter) poll(timeout time.Duration) {
+	client := &query.Client{Timeout: timeout}
+	polled := make([][]query.Attributes, len(a.config.Servers))
+	done := make(DoneChannel)
+
+	for i, addr := range a.config.Servers {
+		go func(i int, addr string) {
+			defer func() { done <- DONE }()
+			// One server per configured address, whose state is kept under
+			// that address whatever it resolves to.
+			servers, err := queryServers(context.Background(), client, false, []string{addr}, true, query.Info)
+			if err != nil {
+				// Unresolvable counts as down.
+				servers = []query.Attributes{{Address: addr, Resolved: addr, Info: query.MaybeInfo{Error: err}}}
+			}
+			polled[i] = servers
+		}(i, addr)
+	}
+	for range a.config.Servers {
+		<-done
+	}
+
+	now := time.Now()
+	for _, servers := range polled {
+		for _, attrs := range servers {
+			a.observe(attrs, now)
+		}
+	}
+	a.flush()
+}
+
+// observe evaluates every rule that applies to one polled server.
+func (a *alerter) observe(attrs query.Attributes, now time.Time) {
+	for i := range a.config.Rules {
+		rule := &a.config.Rules[i]
+		if !rule.appliesTo(attrs.Address) {
+			continue
+		}
+
+		key := rule.Name + "|" + attrs.Address
+		state, ok := a.states[key]
+		if !ok {
+			state = &alertState{}
+			a.states[key] = state
+		}
+
+		alert := Alert{
+			Rule:      rule.Name,
+			Condition: rule.When,
+			Server:    attrs.Resolved,
+			Time:      now,
+		}
+		if attrs.Info.Error == nil {
+			alert.Name = attrs.Info.Info.GetName()
+		} else {
+			alert.Error = attrs.Info.Error.Error()
+		}
+
+		switch rule.cond.kind {
+		case alertDown:
+			a.threshold(rule, state, alert, attrs.Info.Error != nil)
+		case alertCompare:
+			// Nothing to compare against while the server is down.
+			if attrs.Info.Error != nil {
+				continue
+			}
+			value := query.ToInt(alertFieldValue(attrs, rule.cond.field))
+			alert.Value = strconv.Itoa(value)
+			a.threshold(rule, state, alert, rule.cond.holds(value))
+		case alertChanged:
+			if attrs.Info.Error != nil {
+				continue
+			}
+			value := query.FieldText(rule.cond.field, alertFieldValue(attrs, rule.cond.field))
+			if state.seen && value != state.last {
+				alert.State = "changed"
+				alert.Value = value
+				alert.Previous = state.last
+				a.fire(rule, alert)
+			}
+			state.last = value
+			state.seen = true
+		}
+	}
+}
+
+// threshold tracks a condition across polls. It fires once when the
+// condition has held for rule.Polls polls in a row, and once more when it
+// stops holding.
+func (a *alerter) threshold(rule *AlertRule, state *alertState, alert Alert, holds bool) {
+	if !holds {
+		state.streak = 0
+		if state.firing {
+			state.firing = false
+			if !rule.NoRecovery {
+				alert.State = "resolved"
+				a.fire(rule, alert)
+			}
+		}
+		return
+	}
+
+	state.streak++
+	if state.streak >= rule.Polls && !state.firing {
+		state.firing = true
+		alert.State = "firing"
+		a.fire(rule, alert)
+	}
+}
+
+func (a *alerter) fire(rule *AlertRule, alert Alert) {
+	log.Printf("%s: %s on %s", alert.State, alert.Rule, alert.Server)
+	a.pending = append(a.pending, pendingAlert{rule, alert})
+}
+
+// flush delivers the alerts of a poll all at once and waits for them, so
+// one slow webhook doesn't delay the others and alerts of the next poll
+// can't overtake them.
+func (a *alerter) flush() {
+	pending := a.pending
+	a.pending = nil
+	if a.notify == nil {
+		return
+	}
+
+	done := make(DoneChannel)
+	for _, p := range pending {
+		go func(p pendingAlert) {
+			defer func() { done <- DONE }()
+			a.notify(p.rule, p.alert)
+		}(p)
+	}
+	for range pending {
+		<-done
+	}
+}
+
+func (rule *AlertRule) appliesTo(addr string) bool {
+	if len(rule.Servers) == 0 {
+		return true
+	}
+	for _, server := range rule.Servers {
+		if server == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (cond alertCondition) holds(value int) bool {
+	switch cond.op {
+	case ">":
+		return value > cond.value
+	case ">=":
+		return value >= cond.value
+	case "<":
+		return value < cond.value
+	case "<=":
+		return value <= cond.value
+	case "==":
+		return value == cond.value
+	case "!=":
+		return value != cond.value
+	}
+	return false
+}
+
+func alertFieldValue(attrs query.Attributes, field string) Any {
+	return query.FieldValue(query.Result{Info: attrs.Info.Info}, field)
+}
+
+// sendAlert delivers an alert to the rule's webhook and command. Failures
+// are logged; the next state change will try again.
+func sendAlert(rule *AlertRule, alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if rule.Webhook != "" {
+		if err := postAlert(rule.Webhook, body); err != nil {
+			log.Printf("Webhook for %s failed: %s", rule.Name, err)
+		}
+	}
+
+	if rule.Command != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), alertNotifyTimeout)
+		defer cancel()
+
+		// The alert is on StdIn as JSON, with the basics in the environment.
+		cmd := exec.CommandContext(ctx, "sh", "-c", rule.Command)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"SOURCEQ_ALERT_RULE="+alert.Rule,
+			"SOURCEQ_ALERT_STATE="+alert.State,
+			"SOURCEQ_ALERT_SERVER="+alert.Server,
+		)
+		if err := cmd.Run(); err != nil {
+			log.Printf("Command for %s failed: %s", rule.Name, err)
+		}
+	}
+}
+
+func postAlert(url string, body []byte) error {
+	client := &http.Client{Timeout: alertNotifyTimeout}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
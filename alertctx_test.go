@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRecorder is an httptest webhook that keeps every alert posted to
+// it.
+type webhookRecorder struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	r := &webhookRecorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(req.Body).Decode(&alert); err != nil {
+			t.Errorf("Bad webhook body: %s", err)
+		}
+		r.mu.Lock()
+		r.alerts = append(r.alerts, alert)
+		r.mu.Unlock()
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// take returns the alerts posted since the last call.
+func (r *webhookRecorder) take() []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alerts := r.alerts
+	r.alerts = nil
+	return alerts
+}
+
+func testAlerter(t *testing.T, rule AlertRule) *alerter {
+	var err error
+	if rule.cond, err = parseAlertCondition(rule.When); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Name == "" {
+		rule.Name = rule.When
+	}
+	if rule.Polls < 1 {
+		rule.Polls = 1
+	}
+
+	a := newAlerter(&AlertConfig{Servers: []string{"tf.example.org"}, Rules: []AlertRule{rule}})
+	a.notify = sendAlert
+	return a
+}
+
+func upServer(resolved string, players byte) query.Attributes {
+	return query.Attributes{
+		Address:  "tf.example.org",
+		Resolved: resolved,
+		Info:     query.MaybeInfo{Info: goseq.ServerInfo{Name: "Example", Players: players}},
+	}
+}
+
+func downServer(resolved string) query.Attributes {
+	return query.Attributes{
+		Address:  "tf.example.org",
+		Resolved: resolved,
+		Info:     query.MaybeInfo{Error: errors.New("i/o timeout")},
+	}
+}
+
+// observe runs one poll's worth of servers through the alerter.
+func observe(a *alerter, servers ...query.Attributes) {
+	for _, attrs := range servers {
+		a.observe(attrs, time.Now())
+	}
+	a.flush()
+}
+
+func alertStates(alerts []Alert) []string {
+	states := make([]string, len(alerts))
+	for i, alert := range alerts {
+		states[i] = alert.State
+	}
+	return states
+}
+
+func checkStates(t *testing.T, poll string, got []Alert, want ...string) {
+	t.Helper()
+	states := alertStates(got)
+	if len(states) != len(want) {
+		t.Fatalf("%s: got alerts %v, want %v", poll, states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("%s: got alerts %v, want %v", poll, states, want)
+		}
+	}
+}
+
+func TestAlertFiresOnceAndRecovers(t *testing.T) {
+	hook := newWebhookRecorder(t)
+	a := testAlerter(t, AlertRule{Name: "down", When: "down", Polls: 2, Webhook: hook.URL})
+
+	observe(a, downServer("203.0.113.7:27015"))
+	checkStates(t, "first failed poll", hook.take())
+
+	observe(a, downServer("203.0.113.7:27015"))
+	alerts := hook.take()
+	checkStates(t, "second failed poll", alerts, "firing")
+	if alerts[0].Rule != "down" || alerts[0].Error != "i/o timeout" {
+		t.Errorf("Unexpected alert %+v", alerts[0])
+	}
+
+	observe(a, downServer("203.0.113.7:27015"))
+	checkStates(t, "third failed poll", hook.take())
+
+	observe(a, upServer("203.0.113.7:27015", 3))
+	alerts = hook.take()
+	checkStates(t, "recovered poll", alerts, "resolved")
+	if alerts[0].Name != "Example" {
+		t.Errorf("Resolved alert has name %q", alerts[0].Name)
+	}
+
+	observe(a, upServer("203.0.113.7:27015", 3))
+	checkStates(t, "healthy poll", hook.take())
+}
+
+func TestAlertNoRecovery(t *testing.T) {
+	hook := newWebhookRecorder(t)
+	a := testAlerter(t, AlertRule{When: "players > 20", Webhook: hook.URL, NoRecovery: true})
+
+	observe(a, upServer("203.0.113.7:27015", 24))
+	alerts := hook.take()
+	checkStates(t, "busy poll", alerts, "firing")
+	if alerts[0].Value != "24" {
+		t.Errorf("Firing alert has value %q", alerts[0].Value)
+	}
+
+	observe(a, upServer("203.0.113.7:27015", 4))
+	checkStates(t, "quiet poll", hook.take())
+}
+
+func TestAlertStateFollowsConfiguredAddress(t *testing.T) {
+	hook := newWebhookRecorder(t)
+	a := testAlerter(t, AlertRule{When: "down", Webhook: hook.URL})
+
+	// The hostname coming back at another IP resolves the alert.
+	observe(a, downServer("203.0.113.7:27015"))
+	observe(a, upServer("198.51.100.9:27015", 0))
+	checkStates(t, "down then up elsewhere", hook.take(), "firing", "resolved")
+}
+
+func TestAlertDeliveryDoesNotBlockPoll(t *testing.T) {
+	// Each webhook call only returns once both have arrived, which they
+	// can't if they're sent one after another.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+	}))
+	defer hook.Close()
+
+	config := &AlertConfig{Rules: []AlertRule{
+		{Name: "a", When: "down", Polls: 1, Webhook: hook.URL},
+		{Name: "b", When: "down", Polls: 1, Webhook: hook.URL},
+	}}
+	for i := range config.Rules {
+		config.Rules[i].cond, _ = parseAlertCondition("down")
+	}
+	a := newAlerter(config)
+	a.notify = sendAlert
+
+	finished := make(chan struct{})
+	go func() {
+		observe(a, downServer("203.0.113.7:27015"))
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(alertNotifyTimeout / 2):
+		t.Fatal("Alerts of one poll were delivered one after another.")
+	}
+}
@@ -0,0 +1,694 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"golang.org/x/term"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type BrowseOptions struct {
+	Region     string            `long:"region" short:"r" default:"USW" description:"Region code to browse. See sourceq master --list-regions"`
+	MasterIP   string            `long:"ip" default:"hl2master.steampowered.com:27011" description:"host:port of the Master server to query."`
+	StartIP    string            `long:"start" default:"" description:"Where to start reading IPs from. Defaults to start of list."`
+	Filters    map[string]string `long:"filter" short:"f" description:"Master filters to use. See sourceq master --list-filters"`
+	Timeout    uint              `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	Favourites string            `long:"favourites" default:"" description:"Favourites file. Defaults to ~/.sourceq/favourites."`
+}
+
+var browseOptions BrowseOptions
+
+const (
+	ansiAltScreenOn  = "\x1b[?1049h"
+	ansiAltScreenOff = "\x1b[?1049l"
+	ansiHideCursor   = "\x1b[?25l"
+	ansiShowCursor   = "\x1b[?25h"
+	ansiHome         = "\x1b[H"
+	ansiClearLine    = "\x1b[K"
+	ansiClearBelow   = "\x1b[J"
+	ansiReverse      = "\x1b[7m"
+	ansiBold         = "\x1b[1m"
+	ansiReset        = "\x1b[0m"
+)
+
+const browseHelp = "↑↓ move  enter details  / filter  s sort  S reverse  r refresh  c copy connect  f favourite  F favourites only  q quit"
+
+type browseColumn struct {
+	title string
+	width int
+	value func(sv query.Result) string
+	less  func(a, b query.Result) bool
+}
+
+var browseColumns = []browseColumn{
+	{
+		title: "IP Addr",
+		width: 21,
+		value: func(sv query.Result) string { return sv.Server.Address() },
+		less:  func(a, b query.Result) bool { return a.Server.Address() < b.Server.Address() },
+	},
+	{
+		title: "Players",
+		width: 7,
+		value: func(sv query.Result) string {
+			return fmt.Sprintf("%d/%d", query.ToInt(sv.Info.GetPlayers()), query.ToInt(sv.Info.GetMaxPlayers()))
+		},
+		less: func(a, b query.Result) bool {
+			return query.ToInt(a.Info.GetPlayers()) < query.ToInt(b.Info.GetPlayers())
+		},
+	},
+	{
+		title: "Ping",
+		width: 4,
+		value: func(sv query.Result) string { return strconv.Itoa(int(sv.Ping / time.Millisecond)) },
+		less:  func(a, b query.Result) bool { return a.Ping < b.Ping },
+	},
+	{
+		title: "Map",
+		width: 18,
+		value: func(sv query.Result) string { return sv.Info.GetMap() },
+		less:  func(a, b query.Result) bool { return a.Info.GetMap() < b.Info.GetMap() },
+	},
+	{
+		title: "Name",
+		width: -1,
+		value: func(sv query.Result) string { return sv.Info.GetName() },
+		less: func(a, b query.Result) bool {
+			return strings.ToLower(a.Info.GetName()) < strings.ToLower(b.Info.GetName())
+		},
+	},
+}
+
+type browseResult struct {
+	generation int
+	total      int
+	err        error
+	sv         *query.Result
+}
+
+type browser struct {
+	options *BrowseOptions
+
+	width  int
+	height int
+
+	generation int
+	total      int
+	pending    int
+	all        []query.Result
+	rows       []query.Result
+
+	filter    string
+	filtering bool
+	sortCol   int
+	sortDesc  bool
+	selected  int
+	offset    int
+
+	favourites     map[string]bool
+	favouritesPath string
+	favouritesOnly bool
+
+	detail        *query.Attributes
+	detailLoading bool
+
+	status string
+}
+
+func browsectx() {
+	log.SetFlags(0)
+	options := &browseOptions
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		log.Fatal("sourceq browse needs an interactive terminal. Use sourceq master for scripts.")
+	}
+
+	b := &browser{
+		options:  options,
+		sortCol:  1,
+		sortDesc: true,
+	}
+
+	var err error
+	b.favouritesPath = options.Favourites
+	if b.favouritesPath == "" {
+		if b.favouritesPath, err = configFilePath(favouritesFileName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if b.favourites, err = loadAddressSet(b.favouritesPath); err != nil {
+		log.Fatal(err)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiAltScreenOff)
+
+	keys := make(chan string)
+	results := make(chan browseResult)
+	details := make(chan query.Attributes)
+
+	go readKeys(keys)
+	b.refresh(results)
+
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+
+	dirty, stale := true, false
+
+	for {
+		if dirty {
+			b.draw()
+			dirty, stale = false, false
+		}
+
+		select {
+		case key, ok := <-keys:
+			if !ok || !b.handleKey(key, results, details) {
+				return
+			}
+			dirty = true
+		case res := <-results:
+			stale = b.addResult(res) || stale
+		case detail := <-details:
+			if b.detail != nil && b.detail.Address == detail.Address {
+				b.detail = &detail
+				b.detailLoading = false
+				dirty = true
+			}
+		case <-tick.C:
+			// Redraw at most a few times a second while results stream in,
+			// and whenever the terminal is resized.
+			if stale {
+				b.rebuild()
+			}
+			width, height, _ := term.GetSize(int(os.Stdout.Fd()))
+			dirty = stale || width != b.width || height != b.height
+		}
+	}
+}
+
+// refresh starts a fresh master query. Results from earlier queries that
+// are still arriving carry an old generation and are dropped.
+func (b *browser) refresh(results chan browseResult) {
+	b.generation++
+	b.all = nil
+	b.rows = nil
+	b.total = 0
+	b.pending = 0
+	b.selected = 0
+	b.offset = 0
+	b.status = "Querying master server..."
+
+	gen := b.generation
+	options := b.options
+	client := &query.Client{Timeout: time.Duration(options.Timeout) * time.Second}
+
+	go func() {
+		ctx := context.Background()
+		servers, err := masterListWithoutBlacklist(ctx, client, query.MasterOptions{
+			Region:  options.Region,
+			Master:  options.MasterIP,
+			Start:   options.StartIP,
+			Filters: options.Filters,
+		})
+		if err != nil {
+			results <- browseResult{generation: gen, err: err}
+			return
+		}
+
+		results <- browseResult{generation: gen, total: len(servers)}
+
+		for sv := range client.QueryServers(ctx, servers) {
+			sv := sv
+			results <- browseResult{generation: gen, sv: &sv}
+		}
+	}()
+}
+
+// addResult records a result and reports whether the table needs a
+// rebuild. Rebuilding is left to the redraw tick so a large master list
+// isn't re-sorted once per server.
+func (b *browser) addResult(res browseResult) bool {
+	if res.generation != b.generation {
+		return false
+	}
+
+	switch {
+	case res.err != nil:
+		b.status = "Master query failed: " + res.err.Error()
+	case res.sv == nil:
+		b.total = res.total
+		b.pending = res.total
+		b.status = ""
+	default:
+		b.pending--
+		if res.sv.Err == nil {
+			b.all = append(b.all, *res.sv)
+		}
+	}
+
+	return true
+}
+
+// rebuild reapplies the filter and sort, keeping the selected server
+// selected when it is still visible.
+func (b *browser) rebuild() {
+	var current string
+	if b.selected < len(b.rows) {
+		current = b.rows[b.selected].Server.Address()
+	}
+
+	needle := strings.ToLower(b.filter)
+	rows := make([]query.Result, 0, len(b.all))
+
+	for _, sv := range b.all {
+		if b.favouritesOnly && !b.favourites[sv.Server.Address()] {
+			continue
+		}
+		if needle != "" && !browseMatches(sv, needle) {
+			continue
+		}
+		rows = append(rows, sv)
+	}
+
+	less := browseColumns[b.sortCol].less
+	sort.SliceStable(rows, func(i, j int) bool {
+		if b.sortDesc {
+			return less(rows[j], rows[i])
+		}
+		return less(rows[i], rows[j])
+	})
+
+	b.rows = rows
+	b.selected = 0
+	for i, sv := range rows {
+		if sv.Server.Address() == current {
+			b.selected = i
+			break
+		}
+	}
+}
+
+func browseMatches(sv query.Result, needle string) bool {
+	haystacks := []string{
+		sv.Server.Address(),
+		sv.Info.GetName(),
+		sv.Info.GetMap(),
+		sv.Info.GetGame(),
+		sv.Info.GetKeywords(),
+	}
+	for _, hay := range haystacks {
+		if strings.Contains(strings.ToLower(hay), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleKey applies one key press and reports whether to keep running.
+func (b *browser) handleKey(key string, results chan browseResult, details chan query.Attributes) bool {
+	if b.filtering {
+		switch key {
+		case "enter":
+			b.filtering = false
+		case "esc":
+			b.filtering = false
+			b.filter = ""
+		case "backspace":
+			if len(b.filter) > 0 {
+				_, size := utf8.DecodeLastRuneInString(b.filter)
+				b.filter = b.filter[:len(b.filter)-size]
+			}
+		case "ctrl-c":
+			return false
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				b.filter += key
+			}
+		}
+		b.rebuild()
+		return true
+	}
+
+	b.status = ""
+	page := b.tableHeight()
+
+	switch key {
+	case "q", "ctrl-c":
+		return false
+	case "up", "k":
+		b.move(-1)
+	case "down", "j":
+		b.move(1)
+	case "pgup":
+		b.move(-page)
+	case "pgdn":
+		b.move(page)
+	case "home", "g":
+		b.move(-len(b.rows))
+	case "end", "G":
+		b.move(len(b.rows))
+	case "/":
+		b.filtering = true
+	case "s":
+		b.sortCol = (b.sortCol + 1) % len(browseColumns)
+		b.rebuild()
+	case "S":
+		b.sortDesc = !b.sortDesc
+		b.rebuild()
+	case "r":
+		b.refresh(results)
+	case "enter":
+		b.loadDetail(details)
+	case "esc":
+		b.detail = nil
+	case "c":
+		if sv, ok := b.current(); ok {
+			connect := "connect " + sv.Server.Address()
+			// OSC 52 asks the terminal itself to set the clipboard.
+			fmt.Print("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(connect)) + "\a")
+			b.status = "Copied '" + connect + "'"
+		}
+	case "f":
+		b.toggleFavourite()
+	case "F":
+		b.favouritesOnly = !b.favouritesOnly
+		b.rebuild()
+	}
+
+	return true
+}
+
+func (b *browser) current() (query.Result, bool) {
+	if b.selected < 0 || b.selected >= len(b.rows) {
+		return query.Result{}, false
+	}
+	return b.rows[b.selected], true
+}
+
+func (b *browser) move(delta int) {
+	b.selected += delta
+	if b.selected >= len(b.rows) {
+		b.selected = len(b.rows) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+}
+
+func (b *browser) toggleFavourite() {
+	sv, ok := b.current()
+	if !ok {
+		return
+	}
+
+	addr := sv.Server.Address()
+	if b.favourites[addr] {
+		delete(b.favourites, addr)
+		b.status = "Removed " + addr + " from favourites"
+	} else {
+		b.favourites[addr] = true
+		b.status = "Added " + addr + " to favourites"
+	}
+
+	if err := saveAddressSet(b.favouritesPath, b.favourites); err != nil {
+		b.status = "Couldn't save favourites: " + err.Error()
+	}
+	if b.favouritesOnly {
+		b.rebuild()
+	}
+}
+
+// loadDetail runs the full server query for the selected row in the
+// background; the result arrives on details.
+func (b *browser) loadDetail(details chan query.Attributes) {
+	sv, ok := b.current()
+	if !ok {
+		return
+	}
+
+	addr := sv.Server.Address()
+	b.detail = &query.Attributes{Address: addr, Resolved: addr}
+	b.detailLoading = true
+
+	client := &query.Client{Timeout: time.Duration(b.options.Timeout) * time.Second}
+
+	go func() {
+		attrs, err := client.QueryServer(context.Background(), addr, query.All)
+		if err != nil {
+			attrs = query.Attributes{Address: addr, Resolved: addr, Info: query.MaybeInfo{Error: err}}
+		}
+		attrs.Address = addr
+		details <- attrs
+	}()
+}
+
+func (b *browser) detailHeight() int {
+	if b.detail == nil {
+		return 0
+	}
+	h := b.height / 2
+	if h > 16 {
+		h = 16
+	}
+	return h
+}
+
+// tableHeight is the number of server rows that fit: the title, column
+// header and footer lines plus the details pane take the rest.
+func (b *browser) tableHeight() int {
+	h := b.height - 3 - b.detailHeight()
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+func (b *browser) draw() {
+	b.width, b.height, _ = term.GetSize(int(os.Stdout.Fd()))
+	if b.width < 20 || b.height < 6 {
+		return
+	}
+
+	lines := make([]string, 0, b.height)
+
+	// Title.
+	order := "▲"
+	if b.sortDesc {
+		order = "▼"
+	}
+	title := fmt.Sprintf("sourceq browse  %s  %d/%d servers", strings.ToUpper(b.options.Region), len(b.rows), b.total)
+	if b.pending > 0 {
+		title += fmt.Sprintf("  (%d querying)", b.pending)
+	}
+	title += fmt.Sprintf("  sort: %s %s", browseColumns[b.sortCol].title, order)
+	if b.favouritesOnly {
+		title += "  [favourites]"
+	}
+	if b.filter != "" {
+		title += "  filter: " + b.filter
+	}
+	lines = append(lines, ansiBold+fitWidth(title, b.width)+ansiReset)
+
+	// Column header and rows.
+	lines = append(lines, ansiReverse+fitWidth(b.formatRow(nil), b.width)+ansiReset)
+
+	height := b.tableHeight()
+	if b.selected < b.offset {
+		b.offset = b.selected
+	}
+	if b.selected >= b.offset+height {
+		b.offset = b.selected - height + 1
+	}
+
+	for i := b.offset; i < b.offset+height; i++ {
+		if i >= len(b.rows) {
+			lines = append(lines, "")
+			continue
+		}
+		sv := b.rows[i]
+		row := fitWidth(b.formatRow(&sv), b.width)
+		if i == b.selected {
+			row = ansiReverse + row + ansiReset
+		}
+		lines = append(lines, row)
+	}
+
+	lines = append(lines, b.detailLines()...)
+
+	// Footer.
+	footer := browseHelp
+	switch {
+	case b.filtering:
+		footer = "/" + b.filter + "_   (enter to keep, esc to clear)"
+	case b.status != "":
+		footer = b.status
+	}
+	lines = append(lines, fitWidth(footer, b.width))
+
+	var out strings.Builder
+	out.WriteString(ansiHome)
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteString("\r\n")
+		}
+		out.WriteString(line)
+		out.WriteString(ansiClearLine)
+	}
+	out.WriteString(ansiClearBelow)
+	fmt.Print(out.String())
+}
+
+// formatRow renders a server row, or the column titles when sv is nil. The
+// last column takes whatever width is left.
+func (b *browser) formatRow(sv *query.Result) string {
+	cells := make([]string, 0, len(browseColumns)+1)
+
+	mark := " "
+	if sv != nil && b.favourites[sv.Server.Address()] {
+		mark = "*"
+	}
+	cells = append(cells, mark)
+
+	used := 1
+	for _, col := range browseColumns {
+		text := col.title
+		if sv != nil {
+			text = query.CleanText(col.value(*sv))
+		}
+		width := col.width
+		if width < 0 {
+			width = b.width - used - 1
+		}
+		cells = append(cells, padded(fitWidth(text, width), width))
+		used += width + 1
+	}
+
+	return strings.Join(cells, " ")
+}
+
+func (b *browser) detailLines() []string {
+	height := b.detailHeight()
+	if height == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, height)
+	attrs := b.detail
+
+	lines = append(lines, strings.Repeat("─", b.width))
+
+	switch {
+	case b.detailLoading:
+		lines = append(lines, "Querying "+attrs.Address+"...")
+	case attrs.Info.Error != nil:
+		lines = append(lines, "Error fetching server info: "+attrs.Info.Error.Error())
+	default:
+		info := attrs.Info.Info
+		lines = append(lines,
+			ansiBold+query.CleanText(info.GetName())+ansiReset,
+			fmt.Sprintf("%s  map %s  %d/%d players (%d bots)  %s %v  VAC %v  version %s  connect %s",
+				info.GetGame(), info.GetMap(),
+				query.ToInt(info.GetPlayers()), query.ToInt(info.GetMaxPlayers()), query.ToInt(info.GetBots()),
+				attrs.Engine, query.FieldText("environment", info.GetEnvironment()),
+				query.ToInt(info.GetVAC()) == 1, info.GetVersion(), attrs.Address),
+		)
+
+		rules := make([]string, 0, len(attrs.Rules.Rules))
+		for key, value := range attrs.Rules.Rules {
+			rules = append(rules, key+"="+value)
+		}
+		sort.Strings(rules)
+		lines = append(lines, fmt.Sprintf("Rules (%d): %s", len(rules), strings.Join(rules, "  ")))
+
+		if attrs.Players.Error != nil {
+			lines = append(lines, "Error fetching player list: "+attrs.Players.Error.Error())
+		} else {
+			lines = append(lines, fmt.Sprintf("Players (%d):", len(attrs.Players.Players)))
+			for _, player := range attrs.Players.Players {
+				lines = append(lines, fmt.Sprintf("  %s  %5d  %s",
+					padded(fitWidth(query.CleanText(player.Name()), 32), 32),
+					player.Score(),
+					player.Duration()-player.Duration()%time.Second))
+			}
+		}
+	}
+
+	for i := range lines {
+		lines[i] = fitWidth(lines[i], b.width)
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines[:height]
+}
+
+// fitWidth cuts text to at most width terminal cells.
+func fitWidth(text string, width int) string {
+	return query.Truncate(text, width)
+}
+
+// readKeys turns raw terminal input into key names such as "up", "enter"
+// or a single character, and closes keys when input ends.
+func readKeys(keys chan<- string) {
+	defer close(keys)
+
+	names := map[string]string{
+		"\x1b[A":  "up",
+		"\x1b[B":  "down",
+		"\x1bOA":  "up",
+		"\x1bOB":  "down",
+		"\x1b[5~": "pgup",
+		"\x1b[6~": "pgdn",
+		"\x1b[H":  "home",
+		"\x1b[F":  "end",
+		"\x1b[1~": "home",
+		"\x1b[4~": "end",
+		"\x1b":    "esc",
+		"\r":      "enter",
+		"\n":      "enter",
+		"\x7f":    "backspace",
+		"\x08":    "backspace",
+		"\x03":    "ctrl-c",
+	}
+
+	buf := make([]byte, 64)
+
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		input := string(buf[:n])
+
+		if strings.HasPrefix(input, "\x1b") {
+			if name, ok := names[input]; ok {
+				keys <- name
+			}
+			continue
+		}
+
+		for _, r := range input {
+			key := string(r)
+			if name, ok := names[key]; ok {
+				key = name
+			}
+			keys <- key
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/hfern/sourceq/query"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache stores successful query results under ~/.sourceq/cache, one
+// file per key.
+type diskCache struct {
+	dir  string
+	ttl  time.Duration
+	read bool
+}
+
+type cacheRecord struct {
+	Stored time.Time
+	Value  json.RawMessage
+}
+
+// openResponseCache returns the cache for ttl seconds, or nil when ttl is
+// 0. With noCache set nothing is read back, but fresh results are still
+// stored for later runs.
+func openResponseCache(ttl uint, noCache bool) (query.Cache, error) {
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	dir, err := configFilePath("cache")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &diskCache{dir: dir, ttl: time.Duration(ttl) * time.Second, read: !noCache}, nil
+}
+
+func (c *diskCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// get decodes the entry for key into value and returns its age, if it is
+// younger than the TTL.
+func (c *diskCache) get(key string, value interface{}) (time.Duration, bool) {
+	if !c.read {
+		return 0, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return 0, false
+	}
+
+	var record cacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return 0, false
+	}
+
+	age := time.Since(record.Stored)
+	if age > c.ttl || age < 0 {
+		return 0, false
+	}
+
+	if err := json.Unmarshal(record.Value, value); err != nil {
+		return 0, false
+	}
+	return age, true
+}
+
+// put stores value under key. The cache is best effort, so failures are
+// ignored.
+func (c *diskCache) put(key string, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(cacheRecord{Stored: time.Now(), Value: encoded})
+	if err != nil {
+		return
+	}
+
+	// Write then rename so parallel queries never read half a file.
+	tmp, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Fetch implements query.Cache.
+func (c *diskCache) Fetch(key string, value interface{}, fill func() error) (time.Duration, error) {
+	if age, ok := c.get(key, value); ok {
+		return age, nil
+	}
+
+	if err := fill(); err != nil {
+		return 0, err
+	}
+
+	c.put(key, value)
+	return 0, nil
+}
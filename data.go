@@ -3,21 +3,10 @@ package main
 import (
 	"fmt"
 	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
 	"strings"
 )
 
-var regionData = map[string]goseq.Region{
-	"USE":   goseq.USEast,
-	"USW":   goseq.USWest,
-	"SA":    goseq.SouthAmerica,
-	"EU":    goseq.Europe,
-	"AS":    goseq.Asia,
-	"AU":    goseq.Australia,
-	"ME":    goseq.MiddleEast,
-	"AF":    goseq.Africa,
-	"OTHER": goseq.RestOfWorld,
-}
-
 var knownFilters = map[string]string{
 	"type":       "Servers running (d)edicated, (l)isten, or (p) SourceTV.",
 	"secure":     "(1) Servers using anti-cheat technology \n(VAC, but potentially others as well).",
@@ -75,7 +64,7 @@ func printKnownFiltersInfo() {
 
 func printRegionInfo() {
 	fmt.Println("Valid Regions:")
-	for region, code := range regionData {
+	for region, code := range query.Regions {
 		fmt.Println("    ", region, "\t", goseq.RegionNames[code])
 	}
 	fmt.Println()
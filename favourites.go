@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const favouritesFileName = "favourites"
+
+// configDir is where sourceq keeps its state between runs.
+func configDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".sourceq"), nil
+}
+
+func configFilePath(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// loadAddressSet reads an address list file into a set. A missing file is
+// an empty set.
+func loadAddressSet(path string) (map[string]bool, error) {
+	set := make(map[string]bool)
+
+	addresses, err := readAddressList(path)
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addresses {
+		set[addr] = true
+	}
+	return set, nil
+}
+
+// saveAddressSet writes set to path, one address per line in sorted order.
+func saveAddressSet(path string, set map[string]bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	addresses := make([]string, 0, len(set))
+	for addr := range set {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	for _, addr := range addresses {
+		out.WriteString(addr + "\n")
+	}
+	return out.Flush()
+}
+
+const blacklistFileName = "blacklist"
+
+// addressLists are the lists sourceq list manages, by name.
+var addressLists = map[string]string{
+	"favourites": favouritesFileName,
+	"blacklist":  blacklistFileName,
+}
+
+// AddressList matches server addresses against a list of exact ip:port
+// entries, bare IPs (any port) and CIDR ranges.
+type AddressList struct {
+	addrs map[string]bool
+	nets  []*net.IPNet
+}
+
+func newAddressList(entries map[string]bool) (*AddressList, error) {
+	list := &AddressList{addrs: make(map[string]bool)}
+
+	for entry := range entries {
+		if strings.Contains(entry, "/") {
+			_, ipnet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("Bad CIDR '%s' in address list.", entry)
+			}
+			list.nets = append(list.nets, ipnet)
+			continue
+		}
+		list.addrs[entry] = true
+	}
+
+	return list, nil
+}
+
+// loadNamedAddressList reads one of the lists in addressLists from the
+// config directory.
+func loadNamedAddressList(name string) (*AddressList, error) {
+	path, err := configFilePath(addressLists[name])
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadAddressSet(path)
+	if err != nil {
+		return nil, err
+	}
+	return newAddressList(entries)
+}
+
+func (l *AddressList) Len() int {
+	return len(l.addrs) + len(l.nets)
+}
+
+func (l *AddressList) Contains(addr string) bool {
+	if l.addrs[addr] {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if l.addrs[host] {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range l.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressListExclude builds the master list filter for the blacklist and,
+// when favouritesOnly is set, the favourites, so that dropped servers are
+// never queried.
+func addressListExclude(blacklist, favouritesOnly bool) (func(addr string) bool, error) {
+	var drop, keep *AddressList
+	var err error
+
+	if blacklist {
+		if drop, err = loadNamedAddressList("blacklist"); err != nil {
+			return nil, err
+		}
+	}
+	if favouritesOnly {
+		if keep, err = loadNamedAddressList("favourites"); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(addr string) bool {
+		if drop != nil && drop.Contains(addr) {
+			return true
+		}
+		return keep != nil && !keep.Contains(addr)
+	}, nil
+}
+
+// masterListWithoutBlacklist lists a master server with blacklisted servers
+// dropped.
+func masterListWithoutBlacklist(ctx context.Context, client *query.Client, opts query.MasterOptions) ([]goseq.Server, error) {
+	exclude, err := addressListExclude(true, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.Exclude = exclude
+
+	servers, _, err := client.MasterList(ctx, opts)
+	return servers, err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var _whereregexp = regexp.MustCompile(`^\s*([a-z]+)\s*(>=|<=|==|!=|>|<|~)\s*(.*?)\s*$`)
+
+// whereClause is one --where condition, such as "free > 0" or "map ~ dust".
+type whereClause struct {
+	field string
+	op    string
+	value string
+}
+
+// parseWhere reads --where conditions. Numeric fields take numbers (and
+// bool fields yes or no); ~ matches a substring, ignoring case.
+func parseWhere(specs []string) ([]whereClause, error) {
+	clauses := make([]whereClause, 0, len(specs))
+
+	for _, spec := range specs {
+		match := _whereregexp.FindStringSubmatch(spec)
+		if match == nil {
+			return nil, fmt.Errorf("Couldn't parse condition '%s'. Use e.g. 'free > 0' or 'map ~ dust'.", spec)
+		}
+
+		clause := whereClause{field: match[1], op: match[2], value: match[3]}
+
+		field, ok := query.LookupField(clause.field)
+		if !ok {
+			return nil, fmt.Errorf("Unknown field '%s'. See --list-fields", clause.field)
+		}
+
+		switch field.Type {
+		case query.BoolField:
+			switch strings.ToLower(clause.value) {
+			case "yes", "true", "1":
+				clause.value = "1"
+			case "no", "false", "0":
+				clause.value = "0"
+			default:
+				return nil, fmt.Errorf("%s is yes or no, not '%s'.", clause.field, clause.value)
+			}
+		case query.IntField:
+			if _, err := strconv.Atoi(clause.value); err != nil && clause.op != "~" {
+				return nil, fmt.Errorf("%s is a number, not '%s'.", clause.field, clause.value)
+			}
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	return clauses, nil
+}
+
+func (w whereClause) matches(sv query.Result) bool {
+	val := query.FieldValue(sv, w.field)
+
+	if w.op == "~" {
+		return strings.Contains(strings.ToLower(query.FieldText(w.field, val)), strings.ToLower(w.value))
+	}
+
+	var cmp int
+	if field, _ := query.LookupField(w.field); field.Type == query.IntField || field.Type == query.BoolField {
+		want, _ := strconv.Atoi(w.value)
+		cmp = query.CompareValues(w.field, val, want)
+	} else {
+		cmp = strings.Compare(strings.ToLower(query.FieldText(w.field, val)), strings.ToLower(w.value))
+	}
+
+	switch w.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	return false
+}
+
+func matchesWhere(clauses []whereClause, sv query.Result) bool {
+	for _, clause := range clauses {
+		if !clause.matches(sv) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortWriter is a query.Printer that holds every row back until the input
+// is done, then hands them to out ordered by one field.
+type sortWriter struct {
+	out   query.Printer
+	field string
+	desc  bool
+	limit int
+
+	fields []query.FieldSpec
+	in     <-chan query.Result
+	rows   []query.Result
+}
+
+// newSortWriter sorts by spec, a field name with an optional leading - for
+// descending order. A limit above 0 keeps only the first rows.
+func newSortWriter(out query.Printer, spec string, limit int) (*sortWriter, error) {
+	w := &sortWriter{out: out, field: strings.TrimPrefix(spec, "-"), desc: strings.HasPrefix(spec, "-"), limit: limit}
+	if _, ok := query.LookupField(w.field); !ok {
+		return nil, fmt.Errorf("Unknown field '%s'. See --list-fields", w.field)
+	}
+	return w, nil
+}
+
+func (w *sortWriter) Init(fields []query.FieldSpec, in <-chan query.Result) {
+	w.fields = fields
+	w.in = in
+	w.rows = make([]query.Result, 0)
+}
+
+func (w *sortWriter) Run() {
+	for sv := range w.in {
+		w.rows = append(w.rows, sv)
+	}
+}
+
+func (w *sortWriter) Done() {
+	sort.SliceStable(w.rows, func(i, j int) bool {
+		a, b := w.rows[i], w.rows[j]
+		// Unreachable servers have nothing to sort by; they go last.
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		cmp := query.CompareValues(w.field, query.FieldValue(a, w.field), query.FieldValue(b, w.field))
+		if w.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	if w.limit > 0 && len(w.rows) > w.limit {
+		w.rows = w.rows[:w.limit]
+	}
+
+	records := make(chan query.Result)
+	printed := query.StartPrinter(w.out, w.fields, records)
+	for _, row := range w.rows {
+		records <- row
+	}
+	close(records)
+	<-printed
+	w.out.Done()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"log"
+	"os"
+	"regexp"
+	"time"
+)
+
+type FindPlayerOptions struct {
+	Region     string            `long:"region" short:"r" default:"USW" description:"Region code to search. See sourceq master --list-regions"`
+	MasterIP   string            `long:"ip" default:"hl2master.steampowered.com:27011" description:"host:port of the Master server to query."`
+	StartIP    string            `long:"start" default:"" description:"Where to start reading IPs from. Defaults to start of list."`
+	Filters    map[string]string `long:"filter" short:"f" description:"Master filters to narrow the search. See sourceq master --list-filters"`
+	Parallel   uint              `long:"parallel" short:"j" default:"64" description:"How many servers to query at once."`
+	Timeout    uint              `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	IgnoreCase bool              `long:"ignore-case" short:"i" default:"false" description:"Match player names case-insensitively."`
+	Divider    string            `long:"divider" default:" ¦ " description:"Characters used to seperate fields."`
+	Json       bool              `long:"json" default:"false" description:"Output one JSON object per match to StdOut"`
+}
+
+var findPlayerOptions FindPlayerOptions
+
+// PlayerMatch is one player whose name matched, and where they are playing.
+type PlayerMatch struct {
+	Address    string
+	ServerName string
+	Name       string
+	Score      int
+	Duration   float64
+}
+
+func findplayerctx(args []string) {
+	log.SetFlags(0)
+	options := &findPlayerOptions
+
+	if len(args) != 1 {
+		log.Fatal(
+			"sourceq find-player needs exactly one player name (a regular expression).\n" +
+				"e.g. sourceq find-player -r EU -f gamedir:tf '^Hunter'")
+	}
+
+	pattern := args[0]
+	if options.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	nameRegexp, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	timeout := time.Duration(options.Timeout) * time.Second
+	client := &query.Client{Timeout: timeout}
+
+	servers, err := masterListWithoutBlacklist(context.Background(), client, query.MasterOptions{
+		Region:  options.Region,
+		Master:  options.MasterIP,
+		Start:   options.StartIP,
+		Filters: options.Filters,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	matches := make(chan []PlayerMatch)
+
+	go searchServers(matches, client, servers, nameRegexp, options.Parallel)
+
+	if !options.Json {
+		fmt.Println(padded("Address", 21) + options.Divider + padded("Player", 20) +
+			options.Divider + paddedR("Scr", 5) + options.Divider + padded("Time", 9) +
+			options.Divider + "Server")
+	}
+
+	found := 0
+	encoder := json.NewEncoder(os.Stdout)
+
+	for _ = range servers {
+		for _, match := range <-matches {
+			found++
+
+			if options.Json {
+				encoder.Encode(match)
+				continue
+			}
+
+			played := time.Duration(match.Duration) * time.Second
+			fmt.Println(padded(match.Address, 21) + options.Divider + padded(query.CleanText(match.Name), 20) +
+				options.Divider + paddedR(fmt.Sprint(match.Score), 5) +
+				options.Divider + padded(played.String(), 9) + options.Divider + query.CleanText(match.ServerName))
+		}
+	}
+
+	log.Println()
+	log.Printf("%d matching players on %d servers searched.\n", found, len(servers))
+}
+
+// searchServers queries the players of every server, at most parallel at a
+// time, and sends the matching players of each server (possibly none) on
+// send as soon as that server is done.
+func searchServers(send chan []PlayerMatch, client *query.Client, servers []goseq.Server, name *regexp.Regexp, parallel uint) {
+	if parallel == 0 {
+		parallel = 1
+	}
+
+	slots := make(chan struct{}, parallel)
+
+	for _, server := range servers {
+		slots <- struct{}{}
+		go func(server goseq.Server) {
+			defer func() { <-slots }()
+			send <- searchServer(client, server, name)
+		}(server)
+	}
+}
+
+// searchServer asks for info along with the players: the client needs it
+// anyway to tell GoldSource servers apart, and it names the server.
+func searchServer(client *query.Client, server goseq.Server, name *regexp.Regexp) []PlayerMatch {
+	addr := server.Address()
+
+	attrs, err := client.QueryServer(context.Background(), addr, query.Info|query.Players)
+	if err != nil || attrs.Players.Error != nil {
+		return nil
+	}
+
+	matches := make([]PlayerMatch, 0)
+	for _, player := range attrs.Players.Players {
+		if !name.MatchString(player.Name()) {
+			continue
+		}
+		matches = append(matches, PlayerMatch{
+			Address:  addr,
+			Name:     player.Name(),
+			Score:    player.Score(),
+			Duration: player.Duration().Seconds(),
+		})
+	}
+
+	if attrs.Info.Error == nil {
+		for i := range matches {
+			matches[i].ServerName = attrs.Info.Info.GetName()
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var _aggregateregexp = regexp.MustCompile(`^(count|sum|avg|min|max)(\(([a-z]+)\))?$`)
+
+// Aggregate is one --agg column, such as count or sum(players).
+type Aggregate struct {
+	name  string
+	fn    string
+	field string
+}
+
+// parseAggregates reads a --agg list like "count,sum(players),avg(ping)".
+func parseAggregates(spec string) ([]Aggregate, error) {
+	aggs := make([]Aggregate, 0)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		match := _aggregateregexp.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("Couldn't parse aggregate '%s'.", part)
+		}
+
+		agg := Aggregate{name: part, fn: match[1], field: match[3]}
+
+		if agg.fn == "count" && agg.field != "" {
+			return nil, fmt.Errorf("count takes no field: '%s'.", part)
+		}
+		if agg.fn != "count" {
+			if agg.field == "" {
+				return nil, fmt.Errorf("%s needs a field, e.g. %s(players).", agg.fn, agg.fn)
+			}
+			if _, err := query.ParseFields(agg.field); err != nil {
+				return nil, err
+			}
+			field, _ := query.LookupField(agg.field)
+			if field.Type != query.IntField {
+				return nil, fmt.Errorf("%s needs a numeric field; '%s' is not.", agg.fn, agg.field)
+			}
+		}
+
+		aggs = append(aggs, agg)
+	}
+
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("No aggregates given.")
+	}
+
+	return aggs, nil
+}
+
+type groupState struct {
+	key    []Any
+	count  int
+	sums   []float64
+	mins   []float64
+	maxes  []float64
+	counts []int
+}
+
+// groupWriter is a query.Printer that folds rows into one record per distinct
+// combination of the group-by fields, then hands those records to out.
+type groupWriter struct {
+	out      query.Printer
+	header   func([]query.FieldSpec)
+	keys     []query.FieldSpec
+	aggs     []Aggregate
+	in       <-chan query.Result
+	groups   map[string]*groupState
+	ordering []string
+}
+
+func newGroupWriter(out query.Printer, keys []query.FieldSpec, aggs []Aggregate, header func([]query.FieldSpec)) *groupWriter {
+	return &groupWriter{
+		out:    out,
+		header: header,
+		keys:   keys,
+		aggs:   aggs,
+	}
+}
+
+func (w *groupWriter) Init(fields []query.FieldSpec, in <-chan query.Result) {
+	w.in = in
+	w.groups = make(map[string]*groupState)
+	w.ordering = make([]string, 0)
+}
+
+func (w *groupWriter) Run() {
+	for sv := range w.in {
+		if sv.Err != nil {
+			continue
+		}
+
+		key := make([]Any, len(w.keys))
+		for i, field := range w.keys {
+			key[i] = groupKeyValue(field.Name, query.FieldValue(sv, field.Name))
+		}
+
+		id := fmt.Sprintf("%#v", key)
+		group, ok := w.groups[id]
+		if !ok {
+			group = &groupState{
+				key:    key,
+				sums:   make([]float64, len(w.aggs)),
+				mins:   make([]float64, len(w.aggs)),
+				maxes:  make([]float64, len(w.aggs)),
+				counts: make([]int, len(w.aggs)),
+			}
+			w.groups[id] = group
+			w.ordering = append(w.ordering, id)
+		}
+
+		group.count++
+
+		for i, agg := range w.aggs {
+			if agg.field == "" {
+				continue
+			}
+			val := float64(query.ToInt(query.FieldValue(sv, agg.field)))
+			if group.counts[i] == 0 || val < group.mins[i] {
+				group.mins[i] = val
+			}
+			if group.counts[i] == 0 || val > group.maxes[i] {
+				group.maxes[i] = val
+			}
+			group.sums[i] += val
+			group.counts[i]++
+		}
+	}
+}
+
+func (w *groupWriter) Done() {
+	rows := make([]query.Result, 0, len(w.ordering))
+
+	for _, id := range w.ordering {
+		group := w.groups[id]
+		values := make(map[string]Any, len(w.keys)+len(w.aggs))
+
+		for i, field := range w.keys {
+			values[field.Name] = group.key[i]
+		}
+		for i, agg := range w.aggs {
+			values[agg.name] = group.result(i, agg)
+		}
+
+		rows = append(rows, query.Result{Values: values})
+	}
+
+	// Largest first by the first aggregate.
+	first := w.aggs[0].name
+	sort.SliceStable(rows, func(i, j int) bool {
+		return aggregateLess(rows[j].Values[first], rows[i].Values[first])
+	})
+
+	fields := make([]query.FieldSpec, 0, len(w.keys)+len(w.aggs))
+	fields = append(fields, w.keys...)
+	for _, agg := range w.aggs {
+		fields = append(fields, query.FieldSpec{Name: agg.name, Length: len(agg.name)})
+	}
+
+	if w.header != nil {
+		w.header(fields)
+	}
+
+	records := make(chan query.Result)
+	printed := query.StartPrinter(w.out, fields, records)
+	for _, row := range rows {
+		records <- row
+	}
+	close(records)
+	<-printed
+	w.out.Done()
+}
+
+// groupKeyValue keeps numbers as numbers so JSON output stays typed, but
+// uses the text form of coded fields such as environment.
+func groupKeyValue(name string, val Any) Any {
+	if field, ok := query.LookupField(name); ok && field.Text != nil {
+		return field.Text(val)
+	}
+	return val
+}
+
+func (g *groupState) result(i int, agg Aggregate) Any {
+	switch agg.fn {
+	case "count":
+		return g.count
+	case "sum":
+		return int(g.sums[i])
+	case "min":
+		return int(g.mins[i])
+	case "max":
+		return int(g.maxes[i])
+	case "avg":
+		if g.counts[i] == 0 {
+			return 0.0
+		}
+		// Two decimals is plenty and keeps text columns tidy.
+		return float64(int(g.sums[i]/float64(g.counts[i])*100+0.5)) / 100
+	}
+	return nil
+}
+
+func aggregateLess(a, b Any) bool {
+	af, aok := a.(float64)
+	bf, bok := b.(float64)
+	if !aok {
+		af = float64(query.ToInt(a))
+	}
+	if !bok {
+		bf = float64(query.ToInt(b))
+	}
+	return af < bf
+}
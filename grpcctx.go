@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"github.com/hfern/sourceq/sourceqpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+type GrpcOptions struct {
+	Listen   string `long:"listen" short:"l" default:"127.0.0.1:50051" description:"Address to serve the gRPC service on."`
+	MasterIP string `long:"ip" default:"hl2master.steampowered.com:27011" description:"host:port of the Master server to query."`
+	Timeout  uint   `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	Parallel uint   `long:"parallel" short:"j" default:"128" description:"Most info queries in flight at once for each listing."`
+}
+
+var grpcOptions GrpcOptions
+
+// grpcMaxAddresses is the most addresses one GetServer call may ask for,
+// and the most servers they may resolve to.
+const grpcMaxAddresses = 32
+
+// grpcService implements the SourceQuery service in sourceqpb/sourceq.proto.
+type grpcService struct {
+	sourceqpb.UnimplementedSourceQueryServer
+
+	options *GrpcOptions
+	client  querier
+}
+
+// querier is what the service needs of a *query.Client, so tests can stand
+// in for the network.
+type querier interface {
+	serverQuerier
+	QueryMaster(ctx context.Context, opts query.MasterOptions) <-chan query.Result
+}
+
+func grpcctx() {
+	log.SetFlags(0)
+	options := &grpcOptions
+
+	listener, err := net.Listen("tcp", options.Listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	sourceqpb.RegisterSourceQueryServer(server, newGrpcService(options))
+
+	log.Println("Serving gRPC on", listener.Addr())
+	log.Fatal(server.Serve(listener))
+}
+
+func newGrpcService(options *GrpcOptions) *grpcService {
+	return &grpcService{
+		options: options,
+		client: &query.Client{
+			Timeout:  time.Duration(options.Timeout) * time.Second,
+			Parallel: int(options.Parallel),
+		},
+	}
+}
+
+// ListServers streams the master listing from the client's result channel,
+// stopping the remaining queries once the limit is reached or the caller
+// goes away.
+func (s *grpcService) ListServers(req *sourceqpb.MasterRequest, stream sourceqpb.SourceQuery_ListServersServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	opts := query.MasterOptions{
+		Region:  req.Region,
+		Master:  req.Master,
+		Start:   req.Start,
+		Filters: req.Filters,
+	}
+	if opts.Region == "" {
+		opts.Region = "USW"
+	}
+	if opts.Master == "" {
+		opts.Master = s.options.MasterIP
+	}
+	if _, ok := query.Regions[strings.ToUpper(opts.Region)]; !ok {
+		return status.Errorf(codes.InvalidArgument, "Region '%s' does not exist.", opts.Region)
+	}
+
+	if !req.NoBlacklist {
+		exclude, err := addressListExclude(true, false)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		opts.Exclude = exclude
+	}
+
+	sent := uint32(0)
+	for sv := range s.client.QueryMaster(ctx, opts) {
+		// Only a failed listing comes without a server.
+		if sv.Server == nil {
+			return status.Error(codes.Unavailable, sv.Err.Error())
+		}
+		if sv.Err != nil && !req.IncludeUnreachable {
+			continue
+		}
+
+		if err := stream.Send(grpcServerResult(sv)); err != nil {
+			return err
+		}
+
+		if sv.Err == nil {
+			sent++
+		}
+		if req.Limit > 0 && sent >= req.Limit {
+			return nil
+		}
+	}
+
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// GetServer queries servers the way sourceq server does.
+func (s *grpcService) GetServer(ctx context.Context, req *sourceqpb.ServerRequest) (*sourceqpb.ServerDetails, error) {
+	if len(req.Addresses) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "At least one address is required.")
+	}
+	if len(req.Addresses) > grpcMaxAddresses {
+		return nil, status.Errorf(codes.InvalidArgument, "At most %d addresses can be queried at once.", grpcMaxAddresses)
+	}
+
+	options := &ServerQueryOptions{
+		NoInfo:    req.NoInfo,
+		NoPlayers: req.NoPlayers,
+		NoRules:   req.NoRules,
+	}
+
+	resolved, err := resolveServers(req.Addresses, req.FirstOnly)
+	if err != nil {
+		return nil, grpcResolveError(err)
+	}
+	if len(resolved) > grpcMaxAddresses {
+		return nil, status.Errorf(codes.InvalidArgument, "The addresses resolve to %d servers; at most %d can be queried at once.",
+			len(resolved), grpcMaxAddresses)
+	}
+
+	servers := queryResolved(ctx, s.client, false, resolved, options.what())
+
+	details := &sourceqpb.ServerDetails{Servers: make([]*sourceqpb.Server, len(servers))}
+	for i, server := range servers {
+		details.Servers[i] = grpcServer(server, options)
+	}
+	return details, nil
+}
+
+func grpcServerResult(sv query.Result) *sourceqpb.ServerResult {
+	result := &sourceqpb.ServerResult{
+		Address:  sv.Server.Address(),
+		Error:    grpcError(sv.Err),
+		PingMs:   uint32(sv.Ping / time.Millisecond),
+		CacheAge: query.AgeSeconds(sv.Age),
+	}
+	if sv.Err == nil {
+		result.Info = grpcServerInfo(sv.Info)
+	}
+	return result
+}
+
+func grpcServer(server query.Attributes, options *ServerQueryOptions) *sourceqpb.Server {
+	ret := &sourceqpb.Server{
+		Address:  server.Address,
+		Resolved: server.Resolved,
+		Engine:   server.Engine,
+	}
+
+	if !options.NoInfo {
+		ret.Info = &sourceqpb.InfoSection{
+			Error:    grpcError(server.Info.Error),
+			CacheAge: query.AgeSeconds(server.Info.Age),
+		}
+		if server.Info.Error == nil {
+			ret.Info.Info = grpcServerInfo(server.Info.Info)
+		}
+	}
+
+	if !options.NoPlayers {
+		ret.Players = &sourceqpb.PlayersSection{
+			Error:    grpcError(server.Players.Error),
+			CacheAge: query.AgeSeconds(server.Players.Age),
+		}
+		for _, player := range server.Players.Players {
+			ret.Players.Players = append(ret.Players.Players, &sourceqpb.Player{
+				Index:    int32(player.Index()),
+				Name:     player.Name(),
+				Score:    int32(player.Score()),
+				Duration: player.Duration().Seconds(),
+			})
+		}
+	}
+
+	if !options.NoRules {
+		ret.Rules = &sourceqpb.RulesSection{
+			Error:    grpcError(server.Rules.Error),
+			CacheAge: query.AgeSeconds(server.Rules.Age),
+			Rules:    server.Rules.Rules,
+		}
+	}
+
+	return ret
+}
+
+func grpcServerInfo(info goseq.ServerInfo) *sourceqpb.ServerInfo {
+	return &sourceqpb.ServerInfo{
+		Name:          info.GetName(),
+		Map:           info.GetMap(),
+		Folder:        info.GetFolder(),
+		Game:          info.GetGame(),
+		AppId:         int32(info.GetID()),
+		Players:       int32(info.GetPlayers()),
+		MaxPlayers:    int32(info.GetMaxPlayers()),
+		Bots:          int32(info.GetBots()),
+		ServerType:    serverTypeName(byte(info.GetServertype())),
+		Environment:   environmentName(byte(info.GetEnvironment())),
+		Password:      info.GetVisibility() == 1,
+		Vac:           info.GetVAC() == 1,
+		Version:       info.GetVersion(),
+		Port:          int32(info.GetPort()),
+		SteamId:       uint64(info.GetSteamID()),
+		GameId:        uint64(info.GetGameID()),
+		Keywords:      info.GetKeywords(),
+		SpectatorPort: int32(info.GetSpectatorPort()),
+		SpectatorName: info.GetSpectatorName(),
+	}
+}
+
+// grpcResolveError tells a malformed address from a failed lookup: only the
+// first is the caller's fault, and only a lookup that didn't find the name
+// is worth no retry.
+func grpcResolveError(err error) error {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if dnsErr.IsNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func grpcError(err error) *sourceqpb.Error {
+	if err == nil {
+		return nil
+	}
+	return &sourceqpb.Error{Message: err.Error()}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"github.com/hfern/sourceq/sourceqpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// stubQuerier stands in for the network: QueryMaster lists its results and
+// QueryServer answers every section for any address, recording what it was
+// asked for.
+type stubQuerier struct {
+	results []query.Result
+
+	mu    sync.Mutex
+	asked []query.What
+}
+
+func (q *stubQuerier) QueryMaster(ctx context.Context, opts query.MasterOptions) <-chan query.Result {
+	results := make(chan query.Result)
+	go func() {
+		defer close(results)
+		for _, sv := range q.results {
+			select {
+			case results <- sv:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
+
+func (q *stubQuerier) QueryServer(ctx context.Context, addr string, what query.What) (query.Attributes, error) {
+	q.mu.Lock()
+	q.asked = append(q.asked, what)
+	q.mu.Unlock()
+
+	return query.Attributes{
+		Address:  addr,
+		Resolved: addr,
+		Engine:   query.EngineSource,
+		Info:     query.MaybeInfo{Info: goseq.ServerInfo{Name: "Example", Map: "cp_badlands"}},
+		Players:  query.MaybePlayers{Players: []query.Player{}},
+		Rules:    query.MaybeRules{Rules: goseq.RuleMap{"sv_cheats": "0"}},
+	}, nil
+}
+
+// listedServer is a master listing result, unreachable when err is set.
+func listedServer(addr string, err error) query.Result {
+	server := goseq.NewServer()
+	server.SetAddress(addr)
+	return query.Result{Server: server, Err: err, Info: goseq.ServerInfo{Name: "Server " + addr}}
+}
+
+// startGrpcService serves the service over an in-memory listener and
+// returns a client connected to it.
+func startGrpcService(t *testing.T, client querier) sourceqpb.SourceQueryClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	sourceqpb.RegisterSourceQueryServer(server, &grpcService{options: &GrpcOptions{}, client: client})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sourceqpb.NewSourceQueryClient(conn)
+}
+
+// listServers collects a whole ListServers stream as addresses, suffixed
+// with " !" for the servers sent with an error.
+func listServers(t *testing.T, client sourceqpb.SourceQueryClient, req *sourceqpb.MasterRequest) ([]string, error) {
+	t.Helper()
+
+	stream, err := client.ListServers(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var got []string
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		if result.Error != nil {
+			if result.Info != nil {
+				t.Errorf("%s has an error and info", result.Address)
+			}
+			got = append(got, result.Address+" !")
+			continue
+		}
+		if result.Info.GetName() != "Server "+result.Address {
+			t.Errorf("%s has info %v", result.Address, result.Info)
+		}
+		got = append(got, result.Address)
+	}
+}
+
+func TestGrpcListServers(t *testing.T) {
+	down := errors.New("i/o timeout")
+	client := startGrpcService(t, &stubQuerier{results: []query.Result{
+		listedServer("203.0.113.1:27015", nil),
+		listedServer("203.0.113.2:27015", down),
+		listedServer("203.0.113.3:27015", nil),
+		listedServer("203.0.113.4:27015", nil),
+	}})
+
+	tests := []struct {
+		req  *sourceqpb.MasterRequest
+		want []string
+	}{
+		{&sourceqpb.MasterRequest{NoBlacklist: true},
+			[]string{"203.0.113.1:27015", "203.0.113.3:27015", "203.0.113.4:27015"}},
+		{&sourceqpb.MasterRequest{NoBlacklist: true, IncludeUnreachable: true},
+			[]string{"203.0.113.1:27015", "203.0.113.2:27015 !", "203.0.113.3:27015", "203.0.113.4:27015"}},
+		// The limit counts servers that answered.
+		{&sourceqpb.MasterRequest{NoBlacklist: true, Limit: 2},
+			[]string{"203.0.113.1:27015", "203.0.113.3:27015"}},
+		{&sourceqpb.MasterRequest{NoBlacklist: true, Limit: 2, IncludeUnreachable: true},
+			[]string{"203.0.113.1:27015", "203.0.113.2:27015 !", "203.0.113.3:27015"}},
+	}
+
+	for _, test := range tests {
+		got, err := listServers(t, client, test.req)
+		if err != nil {
+			t.Errorf("ListServers(%v): %s", test.req, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListServers(%v) = %v, want %v", test.req, got, test.want)
+		}
+	}
+}
+
+func TestGrpcListServersBadRegion(t *testing.T) {
+	client := startGrpcService(t, &stubQuerier{})
+	_, err := listServers(t, client, &sourceqpb.MasterRequest{Region: "MARS", NoBlacklist: true})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Got %v, want InvalidArgument", err)
+	}
+}
+
+func TestGrpcGetServerBadAddresses(t *testing.T) {
+	client := startGrpcService(t, &stubQuerier{})
+
+	tooMany := make([]string, grpcMaxAddresses+1)
+	for i := range tooMany {
+		tooMany[i] = "203.0.113.1:" + strconv.Itoa(27015+i)
+	}
+
+	for _, addresses := range [][]string{nil, {""}, {"203.0.113.1:27015:1"}, tooMany} {
+		_, err := client.GetServer(context.Background(), &sourceqpb.ServerRequest{Addresses: addresses})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetServer of %d addresses: got %v, want InvalidArgument", len(addresses), err)
+		}
+	}
+}
+
+func TestGrpcGetServerSections(t *testing.T) {
+	tests := []struct {
+		req  *sourceqpb.ServerRequest
+		what query.What
+	}{
+		{&sourceqpb.ServerRequest{}, query.All},
+		{&sourceqpb.ServerRequest{NoInfo: true}, query.Players | query.Rules},
+		{&sourceqpb.ServerRequest{NoPlayers: true}, query.Info | query.Rules},
+		{&sourceqpb.ServerRequest{NoRules: true}, query.Info | query.Players},
+		{&sourceqpb.ServerRequest{NoInfo: true, NoPlayers: true, NoRules: true}, 0},
+	}
+
+	for _, test := range tests {
+		stub := &stubQuerier{}
+		client := startGrpcService(t, stub)
+
+		test.req.Addresses = []string{"203.0.113.7:27015"}
+		details, err := client.GetServer(context.Background(), test.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(details.Servers) != 1 {
+			t.Fatalf("Got %d servers, want 1", len(details.Servers))
+		}
+		server := details.Servers[0]
+
+		if len(stub.asked) != 1 || stub.asked[0] != test.what {
+			t.Errorf("%v asked for %v, want %b", test.req, stub.asked, test.what)
+		}
+		if (server.Info != nil) != !test.req.NoInfo || (server.Players != nil) != !test.req.NoPlayers ||
+			(server.Rules != nil) != !test.req.NoRules {
+			t.Errorf("%v got sections info %t, players %t, rules %t", test.req,
+				server.Info != nil, server.Players != nil, server.Rules != nil)
+		}
+		if server.Info != nil && server.Info.Info.GetMap() != "cp_badlands" {
+			t.Errorf("Got info %v", server.Info)
+		}
+		if server.Rules != nil && server.Rules.Rules["sv_cheats"] != "0" {
+			t.Errorf("Got rules %v", server.Rules)
+		}
+	}
+}
+
+func TestGrpcResolveError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{errors.New("Empty server address."), codes.InvalidArgument},
+		{&net.AddrError{Err: "too many colons in address", Addr: "203.0.113.7:27015:1"}, codes.InvalidArgument},
+		{&net.DNSError{Err: "no such host", Name: "nosuch.example.org", IsNotFound: true}, codes.NotFound},
+		{&net.DNSError{Err: "i/o timeout", Name: "tf.example.org", IsTimeout: true}, codes.Unavailable},
+		{&net.DNSError{Err: "server misbehaving", Name: "tf.example.org", IsTemporary: true}, codes.Unavailable},
+	}
+
+	for _, test := range tests {
+		if code := status.Code(grpcResolveError(test.err)); code != test.code {
+			t.Errorf("%v: got %s, want %s", test.err, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"github.com/hfern/sourceq/query"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+type LanOptions struct {
+	Interface string `long:"interface" short:"i" default:"" description:"Only broadcast on this network interface (e.g. eth0). Defaults to all."`
+	Ports     string `long:"ports" short:"p" default:"27015-27020" description:"Ports to broadcast to, e.g. 27015-27020"`
+	Window    uint   `long:"window" short:"w" default:"3" description:"Seconds to collect replies for."`
+	Fields    string `long:"fields" default:"ip=21,name" description:"The fields to be included. See sourceq master --list-fields"`
+	Divider   string `long:"divider" default:" ¦ " description:"Characters used to seperate fields."`
+	MaxWidth  int    `long:"max-width" default:"0" description:"Cut text rows to this many columns with an ellipsis. 0 fits the terminal; -1 never cuts."`
+	Color     string `long:"color" default:"auto" description:"Colour text output: auto (on a terminal, unless $NO_COLOR is set), always or never. Style it in ~/.sourceq/theme.yaml."`
+	NoHeader  bool   `long:"no-header" default:"false" description:"Don't show header w/ column names."`
+	Format    string `long:"format" default:"text" description:"Output format: text or json."`
+}
+
+var lanOptions LanOptions
+
+func lanctx() {
+	log.SetFlags(0)
+	options := &lanOptions
+
+	ports, err := parsePortList(options.Ports)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	broadcasts, err := query.BroadcastAddresses(options.Interface)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fields, err := query.ParseFields(options.Fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	textOptions, err := printerOptions(options.Divider, options.MaxWidth, options.Color)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer, err := query.NewPrinter(options.Format, os.Stdout, textOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	targets := make([]*net.UDPAddr, 0, len(broadcasts)*len(ports))
+	for _, bcast := range broadcasts {
+		for _, port := range ports {
+			targets = append(targets, &net.UDPAddr{IP: bcast, Port: port})
+		}
+	}
+
+	replies, err := query.DiscoverLAN(context.Background(), targets, time.Duration(options.Window)*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !options.NoHeader && options.Format == "text" {
+		query.WriteHeader(os.Stdout, fields, textOptions)
+	}
+
+	printer := make(chan query.Result)
+	printed := query.StartPrinter(writer, fields, printer)
+
+	found := 0
+	for reply := range replies {
+		printer <- reply
+		found++
+	}
+
+	close(printer)
+	<-printed
+	writer.Done()
+
+	log.Println()
+	log.Printf("%d servers answered on the LAN.\n", found)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+)
+
+type ListOptions struct{}
+
+var listOptions ListOptions
+
+const listUsage = "Usage: sourceq list add|remove|show favourites|blacklist [ADDR...]"
+
+func listctx(args []string) {
+	log.SetFlags(0)
+
+	if len(args) < 2 {
+		log.Fatal(listUsage)
+	}
+
+	action, name, addrs := args[0], args[1], args[2:]
+
+	file, ok := addressLists[name]
+	if !ok {
+		log.Fatalf("Unknown list '%s'. Use favourites or blacklist.", name)
+	}
+
+	path, err := configFilePath(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	set, err := loadAddressSet(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch action {
+	case "show":
+		entries := make([]string, 0, len(set))
+		for entry := range set {
+			entries = append(entries, entry)
+		}
+		sort.Strings(entries)
+		for _, entry := range entries {
+			fmt.Println(entry)
+		}
+		return
+	case "add", "remove":
+	default:
+		log.Fatal(listUsage)
+	}
+
+	if len(addrs) == 0 {
+		log.Fatal(listUsage)
+	}
+
+	for _, addr := range addrs {
+		if err := validateListEntry(name, addr); err != nil {
+			log.Fatal(err)
+		}
+		if action == "add" {
+			set[addr] = true
+		} else {
+			delete(set, addr)
+		}
+	}
+
+	if err := saveAddressSet(path, set); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// validateListEntry checks addr has a form the list can match: favourites
+// are ip:port, the blacklist also takes bare IPs and CIDR ranges.
+func validateListEntry(name, addr string) error {
+	if host, port, err := net.SplitHostPort(addr); err == nil && port != "" && net.ParseIP(host) != nil {
+		return nil
+	}
+
+	if name == "blacklist" {
+		if net.ParseIP(addr) != nil {
+			return nil
+		}
+		if _, _, err := net.ParseCIDR(addr); err == nil {
+			return nil
+		}
+		return fmt.Errorf("'%s' is not an ip, ip:port or CIDR range.", addr)
+	}
+
+	return fmt.Errorf("'%s' is not an ip:port address.", addr)
+}
@@ -10,11 +10,29 @@ type Context int
 const (
 	MASTERQUERY Context = iota
 	SINGLESERVER
+	SCAN
+	LAN
+	RCON
+	FINDPLAYER
+	BROWSE
+	LIST
+	SERVE
+	ALERT
+	GRPC
 )
 
 type MainOptions struct {
 	Master MasterQueryOptions `command:"master"`
 	Server ServerQueryOptions `command:"server"`
+	Scan   ScanOptions        `command:"scan"`
+	Lan    LanOptions         `command:"lan"`
+	Rcon   RconOptions        `command:"rcon"`
+	Find   FindPlayerOptions  `command:"find-player"`
+	Browse BrowseOptions      `command:"browse"`
+	List   ListOptions        `command:"list"`
+	Serve  ServeOptions       `command:"serve"`
+	Alert  AlertOptions       `command:"alert"`
+	Grpc   GrpcOptions        `command:"grpc"`
 }
 
 var ctx Context
@@ -32,6 +50,42 @@ func main() {
 
 	parser.AddCommand("server", "Query Game Server", "Query a specific game server for information.", &serverSingleOptions)
 
+	parser.AddCommand("scan", "Scan for Game Servers",
+		"Probe hosts or CIDR ranges over a set of ports for Source servers. "+
+			"Display responding servers in row format.", &scanOptions)
+
+	parser.AddCommand("lan", "Discover LAN Servers",
+		"Broadcast A2S_INFO on the local network, like the in-game LAN browser. "+
+			"Display responding servers in row format.", &lanOptions)
+
+	parser.AddCommand("rcon", "Remote Console",
+		"Run an RCON command on one or more servers, "+
+			"or open an interactive prompt when no command is given.", &rconOptions)
+
+	parser.AddCommand("find-player", "Find a Player",
+		"Search every server the Master Server lists for players whose name matches a regular expression. "+
+			"Matches are printed as they are found.", &findPlayerOptions)
+
+	parser.AddCommand("browse", "Browse Servers",
+		"Open a full-screen server browser over the Master Server list. "+
+			"Sort, filter, inspect and favourite servers from the keyboard.", &browseOptions)
+
+	parser.AddCommand("list", "Manage Address Lists",
+		"Add, remove or show entries in the favourites and blacklist files. "+
+			"sourceq master drops blacklisted servers and can restrict itself to favourites.", &listOptions)
+
+	parser.AddCommand("serve", "Serve HTTP API",
+		"Serve master and server queries as a JSON HTTP API, "+
+			"with short-lived caching and a cap on concurrent upstream queries.", &serveOptions)
+
+	parser.AddCommand("alert", "Alert on Server Changes",
+		"Poll the servers in a YAML config and evaluate its rules, "+
+			"posting to a webhook or running a command when a rule fires or recovers.", &alertOptions)
+
+	parser.AddCommand("grpc", "Serve gRPC API",
+		"Serve master and server queries as the gRPC service in sourceqpb/sourceq.proto, "+
+			"streaming master listings as servers answer.", &grpcOptions)
+
 	extra, err := parser.Parse()
 
 	if err != nil {
@@ -45,5 +99,32 @@ func main() {
 	case "server":
 		ctx = SINGLESERVER
 		serverctx(extra)
+	case "scan":
+		ctx = SCAN
+		scanctx(extra)
+	case "lan":
+		ctx = LAN
+		lanctx()
+	case "rcon":
+		ctx = RCON
+		rconctx(extra)
+	case "find-player":
+		ctx = FINDPLAYER
+		findplayerctx(extra)
+	case "browse":
+		ctx = BROWSE
+		browsectx()
+	case "list":
+		ctx = LIST
+		listctx(extra)
+	case "serve":
+		ctx = SERVE
+		servectx()
+	case "alert":
+		ctx = ALERT
+		alertctx()
+	case "grpc":
+		ctx = GRPC
+		grpcctx()
 	}
 }
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"golang.org/x/term"
 	"log"
-	"regexp"
-	"strconv"
+	"os"
 	"strings"
 	"time"
 )
@@ -20,6 +20,8 @@ type MasterQueryOptions struct {
 	// TODO(hunter): Add this
 	MasterIP string `long:"ip" default:"hl2master.steampowered.com:27011" description:"host:port of the Master server to query."`
 	Divider  string `long:"divider" default:" ¦ " description:"Characters used to seperate fields."`
+	MaxWidth int    `long:"max-width" default:"0" description:"Cut text rows to this many columns with an ellipsis. 0 fits the terminal; -1 never cuts."`
+	Color    string `long:"color" default:"auto" description:"Colour text output: auto (on a terminal, unless $NO_COLOR is set), always or never. Style it in ~/.sourceq/theme.yaml."`
 	// TODO(hunter): Add this
 	StartIP            string `long:"start" default:"" description:"Where to start reading IPs from. Defaults to start of list."`
 	Limit              int    `long:"limit" short:"l" default:"0" description:"Limit the result set to n successful rows."`
@@ -29,18 +31,32 @@ type MasterQueryOptions struct {
 	// TODO(hunter): Add this
 	Filters map[string]string `long:"filter" short:"f" description:"Filters to use. See --list-filters"`
 	// TODO(hunter): Add this
-	ListFilters bool `long:"list-filters" default:"false" description:"List known filters." group:"Lists"`
-	ListRegions bool `long:"list-regions" default:"false" description:"List Regions." group:"Lists"`
-	ListFields  bool `long:"list-fields" default:"false" description:"List Server Fields." group:"Lists"`
-	Json        bool `long:"json" default:"false" description:"Output as JSON to StdOut"`
-	OnlyIPs     bool `long:"only-ips" short:"Q" default:"false" description:"Only print IPs of the servers."`
-	Timeout     uint `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	ListFilters bool     `long:"list-filters" default:"false" description:"List known filters." group:"Lists"`
+	ListRegions bool     `long:"list-regions" default:"false" description:"List Regions." group:"Lists"`
+	ListFields  bool     `long:"list-fields" default:"false" description:"List Server Fields." group:"Lists"`
+	Markdown    bool     `long:"markdown" default:"false" description:"With --list-fields, print the list as markdown for the README." group:"Lists"`
+	Json        bool     `long:"json" default:"false" description:"Output as JSON to StdOut"`
+	Format      string   `long:"format" default:"" description:"Output format: text, json, table, markdown or html (a page with sortable columns)."`
+	Table       bool     `long:"table" default:"false" description:"Print a bordered table sized to the rows, with totals, once all are in. Rows stream as usual when StdOut isn't a terminal."`
+	OnlyIPs     bool     `long:"only-ips" short:"Q" default:"false" description:"Only print IPs of the servers."`
+	Timeout     uint     `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	Summary     bool     `long:"summary" short:"S" default:"false" description:"Print totals and distributions (by map, game, OS, VAC, version and fill) instead of rows."`
+	SummaryTop  int      `long:"summary-top" default:"10" description:"Rows shown per --summary distribution before folding the rest (0 for all)."`
+	GroupBy     string   `long:"group-by" short:"g" default:"" description:"Print one row per distinct value of these fields (e.g. map,game) instead of one per server."`
+	Aggregates  string   `long:"agg" default:"count" description:"Aggregates for --group-by: count, sum(field), avg(field), min(field), max(field)."`
+	Sort        string   `long:"sort" default:"" description:"Print rows ordered by this field once all are in; prefix with - for descending (e.g. -free)."`
+	Template    string   `long:"template" default:"" description:"Print each server with a Go text/template, e.g. '{{.ip}} {{.name | trunc 30}}'. See the README for functions."`
+	Where       []string `long:"where" short:"w" description:"Only print rows matching a condition such as 'free > 0' or 'map ~ dust'. Repeat to require several."`
+
+	FavouritesOnly bool `long:"favourites-only" default:"false" description:"Only query servers in the favourites list. See sourceq list"`
+	NoBlacklist    bool `long:"no-blacklist" default:"false" description:"Don't drop servers matched by the blacklist. See sourceq list"`
+
+	CacheTTL uint `long:"cache-ttl" default:"0" description:"Reuse the master list and server info cached on disk within this many seconds (0 disables the cache)."`
+	NoCache  bool `long:"no-cache" default:"false" description:"Query the servers even if a cached result is fresh."`
 }
 
 var masterOptions MasterQueryOptions
 
-var _fieldregexp = regexp.MustCompile(`\s*(([a-z]+)(=(\d+))?)\s*,?\s*`)
-
 type infoPrinter func()
 
 func masterctx() {
@@ -50,18 +66,11 @@ func masterctx() {
 		return
 	}
 
+	assertLogicalMasterFlags(&masterOptions)
+
 	unreachable := 0
 	errorsEncountererd := make([]error, 0)
 
-	userRegionStr := strings.ToUpper(masterOptions.Region)
-
-	region, found := regionData[userRegionStr]
-
-	if !found {
-		fmt.Errorf("Region '%s' does not exist.", masterOptions.Region)
-		return
-	}
-
 	if masterOptions.OnlyIPs {
 		masterOptions.Fields = "ip"
 		masterOptions.NoHeader = true
@@ -69,195 +78,228 @@ func masterctx() {
 		masterOptions.NoShowErrorSummary = true
 	}
 
-	fields, err := parseFields(masterOptions.Fields, serverFieldProperties)
+	fields, err := query.ParseFields(masterOptions.Fields)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	master := goseq.NewMasterServer()
-	master.SetRegion(region)
-
-	master.SetAddr(masterOptions.MasterIP)
-
-	startIp := string(goseq.NoAddress)
+	where, err := parseWhere(masterOptions.Where)
 
-	if masterOptions.StartIP != "" {
-		startIp = masterOptions.StartIP
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Apply filters
-	filt := master.GetFilter()
-	for fname, fval := range masterOptions.Filters {
-		filt.Set(fname, fval)
+	cache, err := openResponseCache(masterOptions.CacheTTL, masterOptions.NoCache)
+
+	if err != nil {
+		log.Fatal(err)
 	}
-	master.SetFilter(filt)
 
-	servers, err := master.Query(startIp)
+	exclude, err := addressListExclude(!masterOptions.NoBlacklist, masterOptions.FavouritesOnly)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	numServers := len(servers)
-
-	rec := make(chan SvResponse)
-	printer := make(chan SvResponse)
+	// The writers are set up before anything goes out to the network, so
+	// a bad field or template fails early.
+	grouped := masterOptions.GroupBy != ""
 
-	//tups := make([]SvResponse, 0, numServers)
+	// A table only helps a reader; piped output streams.
+	table := masterOptions.Table && term.IsTerminal(int(os.Stdout.Fd()))
 
-	timeout := time.Duration(masterOptions.Timeout) * time.Second
+	format := "text"
+	if masterOptions.Json {
+		format = "json"
+	} else if table {
+		format = "table"
+	} else if masterOptions.Format != "" {
+		format = masterOptions.Format
+	}
 
-	if !masterOptions.Serial {
-		go AsyncQueryServers(rec, servers, timeout)
-	} else {
-		go serialQueryServers(rec, servers, timeout)
+	textOptions, err := printerOptions(masterOptions.Divider, masterOptions.MaxWidth, masterOptions.Color)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer, err := query.NewPrinter(format, os.Stdout, textOptions)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	var writer Printer
+	templated := masterOptions.Template != ""
 
-	if masterOptions.Json {
-		writer = &jsonWriter{}
-	} else {
-		writer = &textWriter{}
+	var templatePrinter *query.TemplatePrinter
+	if templated {
+		tmpl, err := query.ParseTemplate(masterOptions.Template)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templatePrinter = query.NewTemplatePrinter(os.Stdout, tmpl)
+		writer = templatePrinter
 	}
 
-	writer.Init(fields, printer)
-	go writer.Run()
+	sorted := masterOptions.Sort != ""
 
-	if !masterOptions.NoHeader && !masterOptions.Json {
-		printHeaderLine(fields, serverFieldProperties)
+	if sorted {
+		if writer, err = newSortWriter(writer, masterOptions.Sort, masterOptions.Limit); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	for i := 0; i < numServers; i++ {
-		//tups = append(tups, <-rec)
-		recd := <-rec
+	if masterOptions.Summary {
+		writer = &summaryWriter{json: masterOptions.Json, top: masterOptions.SummaryTop}
+	}
 
-		if recd.err != nil {
-			errorsEncountererd = append(errorsEncountererd, recd.err)
+	if grouped {
+		keys, err := query.ParseFields(masterOptions.GroupBy)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		if recd.err != nil && !masterOptions.NoShowUnreachable {
-			unreachable++
-			continue
+		aggs, err := parseAggregates(masterOptions.Aggregates)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		if masterOptions.Limit > 0 && i >= masterOptions.Limit {
-			continue
+		var header func([]query.FieldSpec)
+		if !masterOptions.NoHeader && format == "text" {
+			header = func(fields []query.FieldSpec) {
+				query.WriteHeader(os.Stdout, fields, textOptions)
+			}
 		}
 
-		printer <- recd
+		writer = newGroupWriter(writer, keys, aggs, header)
 	}
 
-	writer.Done()
+	client := &query.Client{
+		Timeout: time.Duration(masterOptions.Timeout) * time.Second,
+		Cache:   cache,
+		Serial:  masterOptions.Serial,
+	}
 
-	close(rec)
-	close(printer)
+	ctx := context.Background()
 
-	log.Println()
+	servers, age, err := client.MasterList(ctx, query.MasterOptions{
+		Region:  masterOptions.Region,
+		Master:  masterOptions.MasterIP,
+		Start:   masterOptions.StartIP,
+		Filters: masterOptions.Filters,
+		Exclude: exclude,
+	})
 
-	if !masterOptions.NoShowUnreachable && !masterOptions.Json {
-		log.Println(unreachable, "unreachable servers were hidden.")
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if !masterOptions.NoShowErrorSummary {
-		log.Printf("Errors Encountered (%dx):\n", len(errorsEncountererd))
-
-		for _, detail := range errorsEncountererd {
-			log.Println("\t", detail)
-		}
+	if age > 0 {
+		log.Printf("Using the master list cached %v ago.\n", age-age%time.Second)
 	}
-}
 
-func serialQueryServers(send chan SvResponse, servers []goseq.Server, timeout time.Duration) {
-	for _, server := range servers {
-		info, err := server.Info(timeout)
-		if err != nil {
-			send <- SvResponse{err: err, server: server}
-		}
-		send <- SvResponse{err: err, server: server, info: info}
+	// When every field comes from the master list and unreachable servers
+	// are shown anyway, there is nothing to ask the servers.
+	used := append([]query.FieldSpec(nil), fields...)
+	for _, clause := range where {
+		used = append(used, query.FieldSpec{Name: clause.field})
+	}
+	if masterOptions.Sort != "" {
+		used = append(used, query.FieldSpec{Name: strings.TrimPrefix(masterOptions.Sort, "-")})
 	}
-}
 
-func AsyncQueryServers(send chan SvResponse, servers []goseq.Server, timeout time.Duration) {
-	for _, server := range servers {
-		go serialQueryServers(send, []goseq.Server{server}, timeout)
+	var rec <-chan query.Result
+	if query.NeedsInfo(used) || !masterOptions.NoShowUnreachable || masterOptions.Summary || grouped || masterOptions.Template != "" {
+		rec = client.QueryServers(ctx, servers)
+	} else {
+		rec = listedServers(servers)
 	}
-}
 
-func parseFields(spec string, properties map[string]FieldProperty) ([]FieldSpec, error) {
-	specs := make([]FieldSpec, 0, 1)
-	found := _fieldregexp.FindAllStringSubmatch(spec, -1)
+	printer := make(chan query.Result)
 
-	if len(found) == 0 && len(strings.TrimSpace(spec)) != 0 {
-		return nil, errors.New("Couldn't parse field list.")
+	if !masterOptions.NoHeader && format == "text" && !masterOptions.Summary && !grouped && !templated {
+		query.WriteHeader(os.Stdout, fields, textOptions)
 	}
 
-	for _, match := range found {
+	printed := query.StartPrinter(writer, fields, printer)
 
-		if _, ok := serverMethodAccessors[match[2]]; !ok {
-			if _, ok = serverProperties[match[2]]; !ok {
-				return nil, errors.New("Attempted to use an unregistered field!")
-			}
+	shown := 0
+	for recd := range rec {
+		if recd.Err != nil {
+			errorsEncountererd = append(errorsEncountererd, recd.Err)
 		}
 
-		sp := FieldSpec{
-			name:   match[2],
-			length: -1,
+		if recd.Err != nil && !masterOptions.NoShowUnreachable {
+			unreachable++
+			continue
 		}
 
-		if def, ok := properties[match[2]]; ok {
-			sp.length = def.size
+		if len(where) > 0 && (recd.Err != nil || !matchesWhere(where, recd)) {
+			continue
 		}
 
-		if match[4] != "" {
-			val, err := strconv.Atoi(match[4])
-			if err == nil {
-				sp.length = val
-			}
+		// A sorted list is cut after sorting instead.
+		if !sorted && masterOptions.Limit > 0 && shown >= masterOptions.Limit {
+			continue
 		}
 
-		specs = append(specs, sp)
+		shown++
+		printer <- recd
 	}
 
-	return specs, nil
-}
-
-func printHeaderLine(fields []FieldSpec, props map[string]FieldProperty) {
-	for i, field := range fields {
-
-		if i > 0 {
-			fmt.Print(masterOptions.Divider)
-		}
+	close(printer)
 
-		title := field.name
+	<-printed
+	writer.Done()
 
-		if prop, ok := props[field.name]; ok {
-			title = prop.name
-		}
+	log.Println()
 
-		sz := len(title)
+	if !masterOptions.NoShowUnreachable && !masterOptions.Json {
+		log.Println(unreachable, "unreachable servers were hidden.")
+	}
 
-		var padL int = 0
-		var padR int = 0
+	if !masterOptions.NoShowErrorSummary {
+		log.Printf("Errors Encountered (%dx):\n", len(errorsEncountererd))
 
-		if sz < field.length {
-			var rem int = field.length - sz
-			padL = rem / 2
-			padR = rem - padL
+		for _, detail := range errorsEncountererd {
+			log.Println("\t", detail)
 		}
+	}
 
-		for j := 0; j < padL; j++ {
-			fmt.Print(" ")
-		}
+	if templatePrinter != nil && templatePrinter.Err() != nil {
+		log.Fatal(templatePrinter.Err())
+	}
+}
 
-		fmt.Print(title)
+// assertLogicalMasterFlags rejects output flags that can't be combined.
+func assertLogicalMasterFlags(options *MasterQueryOptions) {
+	grouped := options.GroupBy != ""
+	templated := options.Template != ""
 
-		for j := 0; j < padR; j++ {
-			fmt.Print(" ")
-		}
+	if options.Table && (options.Json || options.Summary || templated) {
+		log.Fatal("--table cannot be used with --json, --summary or --template")
+	}
+	if options.Format != "" && (options.Json || options.Table || options.Summary || templated) {
+		log.Fatal("--format cannot be used with --json, --table, --summary or --template")
+	}
+	if templated && (options.Json || options.Summary || grouped) {
+		log.Fatal("--template cannot be used with --json, --summary or --group-by")
 	}
-	fmt.Print("\n")
+	if options.Summary && grouped {
+		log.Fatal("--summary cannot be used with --group-by")
+	}
+	if options.Sort != "" && (options.Summary || grouped) {
+		log.Fatal("--sort cannot be used with --summary or --group-by")
+	}
+}
+
+// listedServers sends the servers as they are, without querying them.
+func listedServers(servers []goseq.Server) <-chan query.Result {
+	results := make(chan query.Result)
+	go func() {
+		defer close(results)
+		for _, server := range servers {
+			results <- query.Result{Server: server, Unqueried: true}
+		}
+	}()
+	return results
 }
 
 type ErrorCount struct {
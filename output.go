@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
+	"os"
+)
+
+const themeFileName = "theme.yaml"
+
+// printerOptions lays text rows out for StdOut. A maxWidth of 0 fits rows
+// to the terminal when StdOut is one; below 0 never cuts them. color is
+// the --color mode.
+func printerOptions(divider string, maxWidth int, color string) (query.PrinterOptions, error) {
+	opts := query.PrinterOptions{Divider: divider, MaxWidth: maxWidth}
+
+	if maxWidth < 0 {
+		opts.MaxWidth = 0
+	} else if maxWidth == 0 {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			opts.MaxWidth = width
+		}
+	}
+
+	theme, err := outputTheme(color)
+	opts.Theme = theme
+	return opts, err
+}
+
+// outputTheme is the theme to colour StdOut with, or nil for none. auto
+// colours a terminal unless NO_COLOR is set.
+func outputTheme(color string) (query.Theme, error) {
+	switch color {
+	case "never":
+		return nil, nil
+	case "always":
+	case "", "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("--color is auto, always or never, not '%s'.", color)
+	}
+
+	return loadTheme()
+}
+
+// loadTheme reads ~/.sourceq/theme.yaml, which may pick a built-in theme
+// as its base and restyle any role:
+//
+//	base: light
+//	full: "bold #ff8700"
+//	empty: 245
+//
+// Without the file the default theme is used.
+func loadTheme() (query.Theme, error) {
+	path, err := configFilePath(themeFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return query.Themes["default"], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var spec map[string]string
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("Couldn't read %s: %s", path, err)
+	}
+
+	name := spec["base"]
+	if name == "" {
+		name = "default"
+	}
+	base, ok := query.Themes[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: there is no built-in theme '%s'.", path, name)
+	}
+
+	theme := make(query.Theme, len(base))
+	for role, style := range base {
+		theme[role] = style
+	}
+
+	for role, text := range spec {
+		if role == "base" {
+			continue
+		}
+		if !query.IsRole(role) {
+			return nil, fmt.Errorf("%s: unknown role '%s'.", path, role)
+		}
+		if theme[role], err = query.ParseStyle(text); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	return theme, nil
+}
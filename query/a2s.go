@@ -0,0 +1,581 @@
+package query
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/hfern/goseq"
+	"hash/crc32"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Raw A2S plumbing for the queries goseq gets wrong: responses that span
+// several UDP datagrams (optionally bzip2-compressed) are reassembled here,
+// and GoldSource replies are understood alongside Source ones.
+// See https://developer.valvesoftware.com/wiki/Server_queries
+
+const (
+	a2sSinglePacket int32 = -1
+	a2sSplitPacket  int32 = -2
+
+	a2sInfoRequest            byte = 0x54
+	a2sInfoResponse           byte = 0x49
+	a2sGoldSourceInfoResponse byte = 0x6D
+	a2sPlayerRequest          byte = 0x55
+	a2sPlayerResponse         byte = 0x44
+	a2sRulesRequest           byte = 0x56
+	a2sRulesResponse          byte = 0x45
+	a2sChallengeResponse      byte = 0x41
+
+	theShipAppID = 2400
+
+	a2sMaxPacketSize = 65507
+	a2sMaxSplits     = 128
+	a2sMaxResponses  = 4
+	a2sMaxChallenges = 3
+	a2sDefaultPort   = "27015"
+)
+
+var (
+	a2sNoChallenge = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	a2sInfoPayload = []byte("Source Engine Query\x00")
+)
+
+var (
+	errA2SShortPacket     = errors.New("A2S packet is too short.")
+	errA2SBadHeader       = errors.New("A2S packet has an unknown header.")
+	errA2SBadSplit        = errors.New("A2S split packet has an invalid number or total.")
+	errA2SBadChecksum     = errors.New("A2S compressed response failed its CRC32 check.")
+	errA2SBadSize         = errors.New("A2S compressed response has the wrong decompressed size.")
+	errA2SUnexpectedReply = errors.New("A2S server sent an unexpected response type.")
+	errA2SNoChallenge     = errors.New("A2S server kept answering with challenges.")
+)
+
+// splitAssembler collects the datagrams of one split response. Parts may
+// arrive in any order; duplicates are dropped.
+type splitAssembler struct {
+	goldSource bool
+	total      int
+	compressed bool
+	size       uint32
+	crc        uint32
+	parts      map[int][]byte
+}
+
+func newSplitAssembler(goldSource bool) *splitAssembler {
+	return &splitAssembler{
+		goldSource: goldSource,
+		parts:      make(map[int][]byte),
+	}
+}
+
+// add consumes a datagram that starts with the split header and reports
+// whether every part of the response has been received.
+func (a *splitAssembler) add(packet []byte) (bool, error) {
+	if a.goldSource {
+		return a.addGoldSource(packet)
+	}
+	return a.addSource(packet)
+}
+
+func (a *splitAssembler) addSource(packet []byte) (bool, error) {
+	if len(packet) < 12 {
+		return false, errA2SShortPacket
+	}
+
+	id := int32(binary.LittleEndian.Uint32(packet[4:8]))
+	total := int(packet[8])
+	number := int(packet[9])
+	payload := packet[12:]
+
+	if a.seen(number) {
+		return a.complete(), nil
+	}
+
+	if number == 0 && uint32(id)&0x80000000 != 0 {
+		if len(payload) < 8 {
+			return false, errA2SShortPacket
+		}
+		a.compressed = true
+		a.size = binary.LittleEndian.Uint32(payload[0:4])
+		a.crc = binary.LittleEndian.Uint32(payload[4:8])
+		payload = payload[8:]
+	}
+
+	if err := a.store(total, number, payload); err != nil {
+		return false, err
+	}
+	return a.complete(), nil
+}
+
+func (a *splitAssembler) addGoldSource(packet []byte) (bool, error) {
+	if len(packet) < 9 {
+		return false, errA2SShortPacket
+	}
+
+	total := int(packet[8] & 0x0F)
+	number := int(packet[8] >> 4)
+
+	if a.seen(number) {
+		return a.complete(), nil
+	}
+
+	if err := a.store(total, number, packet[9:]); err != nil {
+		return false, err
+	}
+	return a.complete(), nil
+}
+
+// seen reports whether part number has already been stored.
+func (a *splitAssembler) seen(number int) bool {
+	_, dup := a.parts[number]
+	return dup
+}
+
+func (a *splitAssembler) store(total, number int, payload []byte) error {
+	if total < 1 || total > a2sMaxSplits || number >= total {
+		return errA2SBadSplit
+	}
+	if a.total == 0 {
+		a.total = total
+	} else if a.total != total {
+		return errA2SBadSplit
+	}
+	a.parts[number] = append([]byte(nil), payload...)
+	return nil
+}
+
+func (a *splitAssembler) complete() bool {
+	return a.total > 0 && len(a.parts) == a.total
+}
+
+// payload joins the parts in order, decompressing when needed. The result
+// still carries the leading single-packet header.
+func (a *splitAssembler) payload() ([]byte, error) {
+	var joined bytes.Buffer
+	for i := 0; i < a.total; i++ {
+		joined.Write(a.parts[i])
+	}
+
+	if !a.compressed {
+		return joined.Bytes(), nil
+	}
+
+	limited := io.LimitReader(bzip2.NewReader(&joined), int64(a.size)+1)
+	data, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(data)) != a.size {
+		return nil, errA2SBadSize
+	}
+	if crc32.ChecksumIEEE(data) != a.crc {
+		return nil, errA2SBadChecksum
+	}
+	return data, nil
+}
+
+// splitResponses keeps one assembler per response id, so that a stray part
+// of an earlier response can't crowd out the response being read.
+type splitResponses struct {
+	goldSource bool
+	byID       map[int32]*splitAssembler
+
+	// err is the last reason a response was given up on, reported if
+	// nothing else completes.
+	err error
+}
+
+func newSplitResponses(goldSource bool) *splitResponses {
+	return &splitResponses{goldSource: goldSource, byID: make(map[int32]*splitAssembler)}
+}
+
+// add files a split datagram under its response id and returns that
+// response's assembler once all of its parts are in.
+func (s *splitResponses) add(packet []byte) *splitAssembler {
+	if len(packet) < 9 {
+		s.err = errA2SShortPacket
+		return nil
+	}
+
+	id := int32(binary.LittleEndian.Uint32(packet[4:8]))
+	assembler, ok := s.byID[id]
+	if !ok {
+		if len(s.byID) >= a2sMaxResponses {
+			return nil
+		}
+		assembler = newSplitAssembler(s.goldSource)
+		s.byID[id] = assembler
+	}
+
+	done, err := assembler.add(packet)
+	if err != nil {
+		s.err = err
+		delete(s.byID, id)
+		return nil
+	}
+	if !done {
+		return nil
+	}
+	delete(s.byID, id)
+	return assembler
+}
+
+// a2sReadResponse reads one logical response from conn, reassembling split
+// packets. The whole response must arrive within timeout. The returned
+// payload starts after the 0xFFFFFFFF header.
+func a2sReadResponse(conn net.Conn, goldSource bool, timeout time.Duration) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	buf := make([]byte, a2sMaxPacketSize)
+	splits := newSplitResponses(goldSource)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			// A malformed split response says more than the timeout it
+			// ended in.
+			if splits.err != nil {
+				return nil, splits.err
+			}
+			return nil, err
+		}
+		if n < 5 {
+			return nil, errA2SShortPacket
+		}
+
+		switch int32(binary.LittleEndian.Uint32(buf[:4])) {
+		case a2sSinglePacket:
+			return append([]byte(nil), buf[4:n]...), nil
+		case a2sSplitPacket:
+			assembler := splits.add(buf[:n])
+			if assembler == nil {
+				continue
+			}
+			data, err := assembler.payload()
+			if err != nil {
+				return nil, err
+			}
+			if len(data) < 5 || int32(binary.LittleEndian.Uint32(data[:4])) != a2sSinglePacket {
+				return nil, errA2SBadHeader
+			}
+			return data[4:], nil
+		default:
+			return nil, errA2SBadHeader
+		}
+	}
+}
+
+// a2sChallengeQuery sends request followed by challenge and returns the
+// type byte and payload of the first reply that is not a challenge. When the
+// server answers with a challenge the request is resent carrying it.
+func a2sChallengeQuery(conn net.Conn, request, challenge []byte, goldSource bool, timeout time.Duration) (byte, []byte, error) {
+	for i := 0; i < a2sMaxChallenges; i++ {
+		packet := append(append([]byte(nil), request...), challenge...)
+
+		if _, err := conn.Write(packet); err != nil {
+			return 0, nil, err
+		}
+
+		resp, err := a2sReadResponse(conn, goldSource, timeout)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if resp[0] != a2sChallengeResponse {
+			return resp[0], resp[1:], nil
+		}
+		if len(resp) < 5 {
+			return 0, nil, errA2SShortPacket
+		}
+		challenge = resp[1:5]
+	}
+
+	return 0, nil, errA2SNoChallenge
+}
+
+// a2sDial connects to a game server, defaulting to the standard port.
+func a2sDial(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, a2sDefaultPort)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return dialer.DialContext(ctx, "udp", addr)
+}
+
+// a2sWatch closes conn as soon as ctx is done, failing any read in flight.
+// Call the returned function once finished with conn.
+func a2sWatch(ctx context.Context, conn net.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// a2sContextErr reports a query cut short by ctx as ctx's error rather than
+// as the closed connection it ended in.
+func a2sContextErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// A2SRules fetches A2S_RULES for addr. Rule lists that are cut short are
+// returned as far as they could be read.
+func A2SRules(ctx context.Context, addr string, goldSource bool, timeout time.Duration) (goseq.RuleMap, error) {
+	conn, err := a2sDial(ctx, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer a2sWatch(ctx, conn)()
+
+	kind, data, err := a2sChallengeQuery(conn, a2sRequest(a2sRulesRequest), a2sNoChallenge, goldSource, timeout)
+	if err != nil {
+		return nil, a2sContextErr(ctx, err)
+	}
+	if kind != a2sRulesResponse {
+		return nil, errA2SUnexpectedReply
+	}
+
+	return parseRules(data)
+}
+
+func parseRules(data []byte) (goseq.RuleMap, error) {
+	rd := a2sReader{data: data}
+	count := int(rd.uint16())
+	if rd.err != nil {
+		return nil, rd.err
+	}
+
+	rules := make(goseq.RuleMap, count)
+
+	for i := 0; i < count; i++ {
+		name := rd.cstring()
+		value := rd.cstring()
+		if rd.err != nil {
+			break
+		}
+		rules[name] = value
+	}
+
+	return rules, nil
+}
+
+// A2SPlayers fetches A2S_PLAYER for addr. Source and GoldSource share the
+// reply layout; only the split-packet framing differs.
+func A2SPlayers(ctx context.Context, addr string, goldSource bool, timeout time.Duration) ([]Player, error) {
+	conn, err := a2sDial(ctx, addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer a2sWatch(ctx, conn)()
+
+	kind, data, err := a2sChallengeQuery(conn, a2sRequest(a2sPlayerRequest), a2sNoChallenge, goldSource, timeout)
+	if err != nil {
+		return nil, a2sContextErr(ctx, err)
+	}
+	if kind != a2sPlayerResponse {
+		return nil, errA2SUnexpectedReply
+	}
+
+	return parsePlayers(data)
+}
+
+func parsePlayers(data []byte) ([]Player, error) {
+	rd := a2sReader{data: data}
+	count := int(rd.byte())
+	if rd.err != nil {
+		return nil, rd.err
+	}
+
+	players := make([]Player, 0, count)
+
+	for i := 0; i < count; i++ {
+		ply := a2sPlayer{
+			index: int(rd.byte()),
+			name:  rd.cstring(),
+			score: int(int32(rd.uint32())),
+		}
+		seconds := math.Float32frombits(rd.uint32())
+		if rd.err != nil {
+			break
+		}
+		ply.duration = time.Duration(float64(seconds) * float64(time.Second))
+		players = append(players, ply)
+	}
+
+	return players, nil
+}
+
+type a2sPlayer struct {
+	index    int
+	name     string
+	score    int
+	duration time.Duration
+}
+
+func (p a2sPlayer) Index() int              { return p.index }
+func (p a2sPlayer) Name() string            { return p.name }
+func (p a2sPlayer) Score() int              { return p.score }
+func (p a2sPlayer) Duration() time.Duration { return p.duration }
+
+// A2SInfo fetches A2S_INFO for addr, accepting both the Source reply and
+// the obsolete GoldSource one.
+func A2SInfo(ctx context.Context, addr string, timeout time.Duration) (goseq.ServerInfo, error) {
+	conn, err := a2sDial(ctx, addr, timeout)
+	if err != nil {
+		return goseq.ServerInfo{}, err
+	}
+	defer conn.Close()
+	defer a2sWatch(ctx, conn)()
+
+	request := append(a2sRequest(a2sInfoRequest), a2sInfoPayload...)
+
+	kind, data, err := a2sChallengeQuery(conn, request, nil, false, timeout)
+	if err != nil {
+		return goseq.ServerInfo{}, a2sContextErr(ctx, err)
+	}
+
+	return parseInfo(kind, data)
+}
+
+// parseInfo reads an A2S_INFO reply of either engine given its type byte.
+func parseInfo(kind byte, data []byte) (goseq.ServerInfo, error) {
+	switch kind {
+	case a2sInfoResponse:
+		return parseSourceInfo(data)
+	case a2sGoldSourceInfoResponse:
+		return parseGoldSourceInfo(data)
+	}
+	return goseq.ServerInfo{}, errA2SUnexpectedReply
+}
+
+func parseSourceInfo(data []byte) (goseq.ServerInfo, error) {
+	rd := a2sReader{data: data}
+	info := goseq.ServerInfo{}
+
+	info.Protocol = rd.byte()
+	info.Name = rd.cstring()
+	info.Map = rd.cstring()
+	info.Folder = rd.cstring()
+	info.Game = rd.cstring()
+	info.ID = int16(rd.uint16())
+	info.Players = rd.byte()
+	info.MaxPlayers = rd.byte()
+	info.Bots = rd.byte()
+	info.Servertype = goseq.ServerType(rd.byte())
+	info.Environment = a2sEnvironment(rd.byte())
+	info.Visibility = goseq.ServerVisibility(rd.byte())
+	info.VAC = goseq.ServerVAC(rd.byte())
+
+	if info.ID == theShipAppID {
+		info.Mode = goseq.TheShipMode(rd.byte())
+		info.Witnesses = rd.byte()
+		info.Duration = rd.byte()
+	}
+
+	info.Version = rd.cstring()
+
+	if rd.err != nil {
+		return goseq.ServerInfo{}, rd.err
+	}
+
+	// The extra data flag and everything after it are optional.
+	edf := rd.byte()
+	if rd.err != nil {
+		return info, nil
+	}
+	if edf&0x80 != 0 {
+		info.Port = int16(rd.uint16())
+	}
+	if edf&0x10 != 0 {
+		info.SteamID = int64(rd.uint64())
+	}
+	if edf&0x40 != 0 {
+		info.SpectatorPort = int16(rd.uint16())
+		info.SpectatorName = rd.cstring()
+	}
+	if edf&0x20 != 0 {
+		info.Keywords = rd.cstring()
+	}
+	if edf&0x01 != 0 {
+		info.GameID = int64(rd.uint64())
+	}
+
+	return info, rd.err
+}
+
+func a2sEnvironment(b byte) goseq.ServerEnvironment {
+	switch b {
+	case 'l', 'L':
+		return goseq.Linux
+	case 'w', 'W':
+		return goseq.Windows
+	}
+	return goseq.ServerEnvironment(b)
+}
+
+func a2sRequest(kind byte) []byte {
+	return []byte{0xFF, 0xFF, 0xFF, 0xFF, kind}
+}
+
+// a2sReader walks the little-endian fields of an A2S payload. The first
+// read past the end sets err and every later read returns a zero value.
+type a2sReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *a2sReader) take(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = errA2SShortPacket
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *a2sReader) byte() byte {
+	return r.take(1)[0]
+}
+
+func (r *a2sReader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.take(2))
+}
+
+func (r *a2sReader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.take(4))
+}
+
+func (r *a2sReader) uint64() uint64 {
+	return binary.LittleEndian.Uint64(r.take(8))
+}
+
+func (r *a2sReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		r.err = errA2SShortPacket
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return s
+}
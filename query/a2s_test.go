@@ -0,0 +1,182 @@
+package query
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readPackets loads a testdata fixture: one hex-encoded datagram per line,
+// with # comments.
+func readPackets(t *testing.T, name string) [][]byte {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	packets := make([][]byte, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		packet, err := hex.DecodeString(line)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		packets = append(packets, packet)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return packets
+}
+
+// replay sends packets to a connected UDP socket over loopback and returns
+// the receiving end.
+func replay(t *testing.T, packets [][]byte) net.Conn {
+	t.Helper()
+
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender.Close() })
+
+	conn, err := net.DialUDP("udp", nil, sender.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for _, packet := range packets {
+		if _, err := sender.WriteToUDP(packet, conn.LocalAddr().(*net.UDPAddr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+var fixtureRules = map[string]string{
+	"sv_cheats":       "0",
+	"mp_timelimit":    "30",
+	"sv_gravity":      "800",
+	"deathmatch":      "1",
+	"coop":            "0",
+	"mp_friendlyfire": "0",
+}
+
+func readRulesFixture(t *testing.T, name string) (map[string]string, error) {
+	t.Helper()
+
+	data, err := a2sReadResponse(replay(t, readPackets(t, name)), false, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if data[0] != a2sRulesResponse {
+		t.Fatalf("reply type %#x, want %#x", data[0], a2sRulesResponse)
+	}
+	return parseRules(data[1:])
+}
+
+func checkRules(t *testing.T, rules map[string]string) {
+	t.Helper()
+
+	if len(rules) != len(fixtureRules) {
+		t.Errorf("got %d rules, want %d: %v", len(rules), len(fixtureRules), rules)
+	}
+	for name, want := range fixtureRules {
+		if rules[name] != want {
+			t.Errorf("rule %s = %q, want %q", name, rules[name], want)
+		}
+	}
+}
+
+func TestSplitOutOfOrderAndDuplicate(t *testing.T) {
+	rules, err := readRulesFixture(t, "source_rules_split.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, rules)
+}
+
+func TestSplitStrayPartOfEarlierResponse(t *testing.T) {
+	rules, err := readRulesFixture(t, "source_rules_stray.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, rules)
+}
+
+func TestSplitBzip2(t *testing.T) {
+	rules, err := readRulesFixture(t, "source_rules_bzip2.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, rules)
+}
+
+func TestSplitBzip2ChecksumMismatch(t *testing.T) {
+	if _, err := readRulesFixture(t, "source_rules_bzip2_badcrc.hex"); err != errA2SBadChecksum {
+		t.Fatalf("got error %v, want %v", err, errA2SBadChecksum)
+	}
+}
+
+func TestSplitGoldSourceHeader(t *testing.T) {
+	data, err := a2sReadResponse(replay(t, readPackets(t, "goldsource_players_split.hex")), true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != a2sPlayerResponse {
+		t.Fatalf("reply type %#x, want %#x", data[0], a2sPlayerResponse)
+	}
+
+	players, err := parsePlayers(data[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name     string
+		score    int
+		duration time.Duration
+	}{
+		{"Gordon", 12, 61500 * time.Millisecond},
+		{"Barney", 3, time.Hour},
+		{"Alyx", 40, 5250 * time.Millisecond},
+	}
+	if len(players) != len(want) {
+		t.Fatalf("got %d players, want %d", len(players), len(want))
+	}
+	for i, w := range want {
+		p := players[i]
+		if p.Name() != w.name || p.Score() != w.score || p.Duration() != w.duration {
+			t.Errorf("player %d = %s/%d/%s, want %s/%d/%s", i, p.Name(), p.Score(), p.Duration(), w.name, w.score, w.duration)
+		}
+	}
+}
+
+func TestSplitTimeoutMidReassembly(t *testing.T) {
+	packets := readPackets(t, "source_rules_split.hex")
+
+	// Only the first two parts of three arrive.
+	conn := replay(t, packets[:2])
+
+	start := time.Now()
+	_, err := a2sReadResponse(conn, false, 200*time.Millisecond)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("gave up after %s", elapsed)
+	}
+}
@@ -0,0 +1,187 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const ansiReset = "\x1b[0m"
+
+// Style is the SGR parameters of an ANSI style, such as "1;33" for bold
+// yellow. The empty Style leaves text as it is.
+type Style string
+
+// Wrap styles text, resetting the style after it.
+func (s Style) Wrap(text string) string {
+	if s == "" || text == "" {
+		return text
+	}
+	return "\x1b[" + string(s) + "m" + text + ansiReset
+}
+
+// With combines two styles; other wins where they clash.
+func (s Style) With(other Style) Style {
+	switch {
+	case s == "":
+		return other
+	case other == "":
+		return s
+	}
+	return s + ";" + other
+}
+
+var styleWords = map[string]string{
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+	"reverse":   "7",
+}
+
+var colourNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// ParseStyle reads a style written as words: attributes (bold, dim,
+// italic, underline, reverse), a colour name (red, bright-red, ...), an
+// xterm colour number (0-255) or #rrggbb, each optionally prefixed with
+// on- for the background. E.g. "bold yellow" or "white on-#303030".
+func ParseStyle(spec string) (Style, error) {
+	params := make([]string, 0)
+
+	for _, word := range strings.Fields(strings.ToLower(spec)) {
+		if param, ok := styleWords[word]; ok {
+			params = append(params, param)
+			continue
+		}
+
+		background := strings.HasPrefix(word, "on-")
+		param, err := colourParam(strings.TrimPrefix(word, "on-"), background)
+		if err != nil {
+			return "", fmt.Errorf("Couldn't read style '%s': %s", spec, err)
+		}
+		params = append(params, param)
+	}
+
+	return Style(strings.Join(params, ";")), nil
+}
+
+func colourParam(colour string, background bool) (string, error) {
+	base, extended := 30, "38"
+	if background {
+		base, extended = 40, "48"
+	}
+
+	if strings.HasPrefix(colour, "bright-") {
+		base += 60
+		colour = strings.TrimPrefix(colour, "bright-")
+	}
+	for i, name := range colourNames {
+		if colour == name {
+			return strconv.Itoa(base + i), nil
+		}
+	}
+
+	if n, err := strconv.Atoi(colour); err == nil && n >= 0 && n <= 255 {
+		return extended + ";5;" + colour, nil
+	}
+
+	if len(colour) == 7 && colour[0] == '#' {
+		if rgb, err := strconv.ParseUint(colour[1:], 16, 32); err == nil {
+			return fmt.Sprintf("%s;2;%d;%d;%d", extended, rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown colour or attribute '%s'.", colour)
+}
+
+// Theme roles, the things text output colours.
+const (
+	RoleHeader      = "header"      // column headers
+	RoleLabel       = "label"       // keys in sourceq server info
+	RoleReachable   = "reachable"   // address of a server that answered
+	RoleUnreachable = "unreachable" // address of a server that didn't
+	RoleFull        = "full"        // player counts of nearly full servers
+	RoleEmpty       = "empty"       // rows of servers without players
+	RolePassword    = "password"    // names of password-protected servers
+	RoleNoVAC       = "novac"       // the vac column of servers without VAC
+	RoleError       = "error"       // error messages
+)
+
+// Theme maps roles to styles. A nil Theme prints without colour.
+type Theme map[string]Style
+
+// Themes are the built-in themes.
+var Themes = map[string]Theme{
+	"default": {
+		RoleHeader:      "1",
+		RoleLabel:       "36",
+		RoleReachable:   "32",
+		RoleUnreachable: "31",
+		RoleFull:        "33",
+		RoleEmpty:       "2",
+		RolePassword:    "35",
+		RoleNoVAC:       "1;31",
+		RoleError:       "31",
+	},
+	// For light backgrounds, where yellow and cyan are hard to read.
+	"light": {
+		RoleHeader:      "1",
+		RoleLabel:       "34",
+		RoleReachable:   "32",
+		RoleUnreachable: "31",
+		RoleFull:        "38;5;166",
+		RoleEmpty:       "38;5;245",
+		RolePassword:    "35",
+		RoleNoVAC:       "1;31",
+		RoleError:       "31",
+	},
+}
+
+// IsRole reports whether name is a theme role.
+func IsRole(name string) bool {
+	_, ok := Themes["default"][name]
+	return ok
+}
+
+// nearlyFull is the fill percentage from which a server counts as full.
+const nearlyFull = 90
+
+// rowStyle is the style of a whole text row. Rows of servers that weren't
+// queried are left unstyled, as nothing is known about them.
+func rowStyle(theme Theme, sv Result) Style {
+	if sv.Unqueried {
+		return ""
+	}
+	if sv.Err == nil && sv.Values == nil && sv.Info.GetPlayers() == 0 {
+		return theme[RoleEmpty]
+	}
+	return ""
+}
+
+// cellStyle is the style of one field of a text row.
+func cellStyle(theme Theme, sv Result, name string) Style {
+	if sv.Values != nil || sv.Unqueried {
+		return ""
+	}
+
+	switch name {
+	case "ip", "connect":
+		if sv.Err != nil {
+			return theme[RoleUnreachable]
+		}
+		return theme[RoleReachable]
+	case "players", "maxplayers", "humans", "free", "fill":
+		if sv.Err == nil && sv.Info.GetMaxPlayers() > 0 && ToInt(fill(sv.Info)) >= nearlyFull {
+			return theme[RoleFull]
+		}
+	case "name", "password", "visibility":
+		if sv.Err == nil && ToInt(sv.Info.GetVisibility()) == 1 {
+			return theme[RolePassword]
+		}
+	case "vac":
+		if sv.Err == nil && ToInt(sv.Info.GetVAC()) != 1 {
+			return theme[RoleNoVAC]
+		}
+	}
+	return ""
+}
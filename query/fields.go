@@ -0,0 +1,361 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hfern/goseq"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldSpec is one column of a --fields list: the field and the width it
+// is padded to in text output (-1 for none).
+type FieldSpec struct {
+	Name   string
+	Length int
+}
+
+// FieldType is the kind of value a field holds.
+type FieldType string
+
+const (
+	StringField FieldType = "string"
+	IntField    FieldType = "int"
+	EnumField   FieldType = "enum" // a small code with a text form, e.g. environment
+	BoolField   FieldType = "bool"
+)
+
+// Total is how a column is summed up in a table footer.
+type Total int
+
+const (
+	NoTotal Total = iota
+	TotalSum
+	TotalAvg
+)
+
+// Alignment is how a field's values sit in a padded text column.
+type Alignment int
+
+const (
+	AlignLeft Alignment = iota
+	AlignRight
+)
+
+// Field describes one field a --fields list can name. The header line,
+// every printer and --list-fields all read fields from here, so a new
+// field only needs adding to fieldList.
+type Field struct {
+	Name        string
+	Header      string
+	Width       int
+	Description string
+	Type        FieldType
+	Align       Alignment
+
+	// NeedsInfo is set for fields read from (or measured by) the A2S_INFO
+	// reply; the others are known from the master list alone.
+	NeedsInfo bool
+
+	// Total is how the table footer sums up the column, if at all.
+	Total Total
+
+	Value func(sv Result) interface{}
+	Text  func(val interface{}) string      // nil prints the value with fmt.Sprint
+	JSON  func(val interface{}) interface{} // nil encodes the value as is
+}
+
+// FormatText is how val appears in text output.
+func (f *Field) FormatText(val interface{}) string {
+	if f.Text != nil {
+		return f.Text(val)
+	}
+	return fmt.Sprint(val)
+}
+
+// FormatJSON is how val is encoded in JSON output.
+func (f *Field) FormatJSON(val interface{}) interface{} {
+	if f.JSON != nil {
+		return f.JSON(val)
+	}
+	return val
+}
+
+func infoValue(get func(info goseq.ServerInfo) interface{}) func(sv Result) interface{} {
+	return func(sv Result) interface{} { return get(sv.Info) }
+}
+
+// fieldList is the registry, in the order --list-fields prints it.
+var fieldList = []*Field{
+	{Name: "bots", Header: "Bots", Width: 5, Description: "Number of Bots", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalSum,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetBots() })},
+	{Name: "connect", Header: "Connect", Width: 37, Description: "steam://connect URL that joins the server", Type: StringField,
+		Value: connectURL},
+	{Name: "duration", Header: "Arrest In", Width: 7, Description: "Will arrest in (The Ship)", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetDuration() })},
+	{Name: "engine", Header: "Engine", Width: 10, Description: "Game engine (Source or GoldSource)", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return infoEngine(info) })},
+	{Name: "environment", Header: "Env", Width: 3, Description: "Environment OS (Lnx, Win or ? for others)", Type: EnumField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetEnvironment() }),
+		Text:  environmentText},
+	{Name: "fill", Header: "Fill%", Width: 5, Description: "Players as a percentage of maxplayers", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalAvg,
+		Value: infoValue(fill)},
+	{Name: "folder", Header: "Folder", Width: 10, Description: "Folder that the game is hosted from.", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetFolder() })},
+	{Name: "game", Header: "Game", Width: 5, Description: "Game being run.", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetGame() })},
+	{Name: "free", Header: "Free", Width: 4, Description: "Free slots (maxplayers - players)", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalSum,
+		Value: infoValue(free)},
+	{Name: "gameid", Header: "GameID", Width: 6, Description: "GameID that the Server is running", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetGameID() })},
+	{Name: "humans", Header: "Hum", Width: 3, Description: "Human players (players - bots)", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalSum,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return ToInt(info.GetPlayers()) - ToInt(info.GetBots()) })},
+	{Name: "id", Header: "ID", Width: 5, Description: "ID of the server.", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetID() })},
+	{Name: "ip", Header: "IP Addr", Width: 21, Description: "IP Address of the Server", Type: StringField,
+		Value: serverAddress},
+	{Name: "keywords", Header: "Keywords", Width: 9, Description: "Keywords, registered by the player", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetKeywords() })},
+	{Name: "map", Header: "Map", Width: 10, Description: "Map currently active (e.g. de_dust2).", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetMap() })},
+	{Name: "maxplayers", Header: "Max", Width: 3, Description: "Maximum number of players allowed", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalSum,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetMaxPlayers() })},
+	{Name: "mode", Header: "Mode", Width: 4, Description: "Mode the server is running", Type: EnumField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetMode() })},
+	{Name: "name", Header: "Name", Width: 15, Description: "Name of Server", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetName() })},
+	{Name: "password", Header: "Pw.", Width: 3, Description: "Is a password required to join? (yes/no)", Type: BoolField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return ToInt(info.GetVisibility()) == 1 }),
+		Text:  yesNo},
+	{Name: "ping", Header: "Ping", Width: 4, Description: "Round trip of the info query in ms", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalAvg,
+		Value: func(sv Result) interface{} { return int(sv.Ping / time.Millisecond) }},
+	{Name: "players", Header: "Ply", Width: 3, Description: "Number Players", Type: IntField, Align: AlignRight, NeedsInfo: true, Total: TotalSum,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetPlayers() })},
+	{Name: "port", Header: "Port", Width: 5, Description: "Port of the server.", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetPort() })},
+	{Name: "servertype", Header: "Type", Width: 5, Description: "Hosting Type (eg dedicated)", Type: EnumField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetServertype() })},
+	{Name: "spectatorname", Header: "Spectator", Width: 9, Description: "Spectator Name", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetSpectatorName() })},
+	{Name: "spectatorport", Header: "SpPort", Width: 7, Description: "Spectator Port", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetSpectatorPort() })},
+	{Name: "steamid", Header: "SteamID", Width: 10, Description: "SteamID of the server.", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetSteamID() })},
+	{Name: "vac", Header: "VAC", Width: 3, Description: "Is the server VAC protected? (yes/no)", Type: BoolField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return ToInt(info.GetVAC()) == 1 }),
+		Text:  yesNo},
+	{Name: "version", Header: "Version", Width: 5, Description: "Version of the server being run.", Type: StringField, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetVersion() })},
+	{Name: "visibility", Header: "Pw.", Width: 3, Description: "Is a password required to join?", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetVisibility() })},
+	{Name: "witnesses", Header: "Witnesses", Width: 10, Description: "# Witnesses for The Ship.", Type: IntField, Align: AlignRight, NeedsInfo: true,
+		Value: infoValue(func(info goseq.ServerInfo) interface{} { return info.GetWitnesses() })},
+}
+
+var fieldIndex = make(map[string]*Field, len(fieldList))
+
+func init() {
+	for _, field := range fieldList {
+		fieldIndex[field.Name] = field
+	}
+}
+
+// Fields lists every registered field.
+func Fields() []*Field {
+	return append([]*Field(nil), fieldList...)
+}
+
+// LookupField finds a registered field by name.
+func LookupField(name string) (*Field, bool) {
+	field, ok := fieldIndex[name]
+	return field, ok
+}
+
+// NeedsInfo reports whether any of fields has to be read from an A2S_INFO
+// reply.
+func NeedsInfo(fields []FieldSpec) bool {
+	for _, spec := range fields {
+		if field, ok := fieldIndex[spec.Name]; !ok || field.NeedsInfo {
+			return true
+		}
+	}
+	return false
+}
+
+func serverAddress(sv Result) interface{} {
+	if sv.Server == nil {
+		return ""
+	}
+	return sv.Server.Address()
+}
+
+func connectURL(sv Result) interface{} {
+	if sv.Server == nil {
+		return ""
+	}
+	return "steam://connect/" + sv.Server.Address()
+}
+
+func free(info goseq.ServerInfo) interface{} {
+	if n := ToInt(info.GetMaxPlayers()) - ToInt(info.GetPlayers()); n > 0 {
+		return n
+	}
+	return 0
+}
+
+func fill(info goseq.ServerInfo) interface{} {
+	max := ToInt(info.GetMaxPlayers())
+	if max <= 0 {
+		return 0
+	}
+	return ToInt(info.GetPlayers()) * 100 / max
+}
+
+func yesNo(val interface{}) string {
+	if val == true {
+		return "yes"
+	}
+	return "no"
+}
+
+// ToInt reads any integer field value, including goseq's byte based enums,
+// or a bool as 0 or 1. Anything else is 0.
+func ToInt(val interface{}) int {
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// CompareValues orders two values of a field: numerically for int and bool
+// fields, otherwise by their text, ignoring case.
+func CompareValues(name string, a, b interface{}) int {
+	if field, ok := fieldIndex[name]; ok && (field.Type == IntField || field.Type == BoolField) {
+		x, y := ToInt(a), ToInt(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(FieldText(name, a)), strings.ToLower(FieldText(name, b)))
+}
+
+func environmentText(val interface{}) string {
+	switch t := val.(type) {
+	case goseq.ServerEnvironment:
+		switch t {
+		case goseq.Linux:
+			return "Lnx"
+		case goseq.Windows:
+			return "Win"
+		default:
+			return "?"
+		}
+	default:
+		return "_"
+	}
+}
+
+var _fieldregexp = regexp.MustCompile(`\s*(([a-z]+)(=(\d+))?)\s*,?\s*`)
+
+// ParseFields reads a --fields list such as "ip=21,name,players".
+func ParseFields(spec string) ([]FieldSpec, error) {
+	specs := make([]FieldSpec, 0, 1)
+	found := _fieldregexp.FindAllStringSubmatch(spec, -1)
+
+	if len(found) == 0 && len(strings.TrimSpace(spec)) != 0 {
+		return nil, errors.New("Couldn't parse field list.")
+	}
+
+	for _, match := range found {
+
+		field, ok := fieldIndex[match[2]]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field '%s'. See --list-fields", match[2])
+		}
+
+		sp := FieldSpec{
+			Name:   field.Name,
+			Length: field.Width,
+		}
+
+		if match[4] != "" {
+			val, err := strconv.Atoi(match[4])
+			if err == nil {
+				sp.Length = val
+			}
+		}
+
+		specs = append(specs, sp)
+	}
+
+	return specs, nil
+}
+
+// FieldValue reads a field of sv, or its precomputed value when sv
+// carries Values.
+func FieldValue(sv Result, name string) interface{} {
+	if sv.Values != nil {
+		return sv.Values[name]
+	}
+	if field, ok := fieldIndex[name]; ok {
+		return field.Value(sv)
+	}
+	return nil
+}
+
+// FieldText is a field value as text output shows it, e.g. the
+// environment as "Lnx" or "Win". Unregistered names use fmt.Sprint.
+func FieldText(name string, val interface{}) string {
+	if field, ok := fieldIndex[name]; ok {
+		return field.FormatText(val)
+	}
+	return fmt.Sprint(val)
+}
+
+// FieldTitle is the column header for a field.
+func FieldTitle(name string) string {
+	if field, ok := fieldIndex[name]; ok {
+		return field.Header
+	}
+	return name
+}
+
+// WriteHeader prints the column headers for fields, each centred in its
+// column.
+func WriteHeader(out io.Writer, fields []FieldSpec, opts PrinterOptions) {
+	var line strings.Builder
+
+	for i, field := range fields {
+		if i > 0 {
+			line.WriteString(opts.Divider)
+		}
+
+		title := FieldTitle(field.Name)
+
+		padL := 0
+		if sz := DisplayWidth(title); sz < field.Length {
+			padL = (field.Length - sz) / 2
+		}
+
+		title = opts.Theme[RoleHeader].Wrap(title)
+		line.WriteString(PadText(strings.Repeat(" ", padL)+title, field.Length, AlignLeft))
+	}
+
+	fmt.Fprintln(out, fitLine(line.String(), opts.MaxWidth))
+}
@@ -0,0 +1,49 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []FieldSpec
+	}{
+		{"", []FieldSpec{}},
+		{"name", []FieldSpec{{"name", 15}}},
+		{"ip=21,name,players", []FieldSpec{{"ip", 21}, {"name", 15}, {"players", 3}}},
+		{" ip , map=8 ", []FieldSpec{{"ip", 21}, {"map", 8}}},
+		{"map=30, ping", []FieldSpec{{"map", 30}, {"ping", 4}}},
+	}
+
+	for _, test := range tests {
+		got, err := ParseFields(test.spec)
+		if err != nil {
+			t.Errorf("ParseFields(%q): %s", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseFields(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseFieldsErrors(t *testing.T) {
+	for _, spec := range []string{"nosuchfield", "name,bogus", "!!!"} {
+		if _, err := ParseFields(spec); err == nil {
+			t.Errorf("ParseFields(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestFieldsAreRegistered(t *testing.T) {
+	for _, field := range Fields() {
+		if found, ok := LookupField(field.Name); !ok || found != field {
+			t.Errorf("Field %s isn't in the index", field.Name)
+		}
+		if field.Header == "" || field.Description == "" || field.Value == nil {
+			t.Errorf("Field %s is missing a header, description or value", field.Name)
+		}
+	}
+}
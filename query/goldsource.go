@@ -0,0 +1,81 @@
+package query
+
+import (
+	"github.com/hfern/goseq"
+	"strconv"
+)
+
+const (
+	EngineSource     = "Source"
+	EngineGoldSource = "GoldSource"
+)
+
+// GoldSource servers speak network protocol 47 or 48, both in the obsolete
+// info reply and in the Source-style one newer HLDS builds send.
+const goldSourceMinProtocol = 47
+
+// The obsolete reply carries no app id, so derive it from the game folder.
+var goldSourceAppIDs = map[string]int16{
+	"valve":    70,
+	"cstrike":  10,
+	"tfc":      20,
+	"dod":      30,
+	"dmc":      40,
+	"gearbox":  50,
+	"ricochet": 60,
+	"czero":    80,
+	"bshift":   130,
+}
+
+// infoEngine reports which engine answered an A2S_INFO query.
+func infoEngine(info goseq.ServerInfo) string {
+	if info.Protocol >= goldSourceMinProtocol {
+		return EngineGoldSource
+	}
+	return EngineSource
+}
+
+// parseGoldSourceInfo reads the obsolete 'm' A2S_INFO reply.
+func parseGoldSourceInfo(data []byte) (goseq.ServerInfo, error) {
+	rd := a2sReader{data: data}
+	info := goseq.ServerInfo{}
+
+	rd.cstring() // address, which we already know
+	info.Name = rd.cstring()
+	info.Map = rd.cstring()
+	info.Folder = rd.cstring()
+	info.Game = rd.cstring()
+	info.Players = rd.byte()
+	info.MaxPlayers = rd.byte()
+	info.Protocol = rd.byte()
+	info.Servertype = goseq.ServerType(lowerASCII(rd.byte()))
+	info.Environment = a2sEnvironment(rd.byte())
+	info.Visibility = goseq.ServerVisibility(rd.byte())
+
+	if isMod := rd.byte(); isMod == 1 {
+		rd.cstring() // mod website
+		rd.cstring() // mod download
+		rd.byte()
+		info.Version = strconv.Itoa(int(rd.uint32()))
+		rd.uint32() // mod size
+		rd.byte()   // multiplayer only
+		rd.byte()   // custom dll
+	}
+
+	info.VAC = goseq.ServerVAC(rd.byte())
+	info.Bots = rd.byte()
+	info.ID = goldSourceAppIDs[info.Folder]
+
+	if info.Protocol < goldSourceMinProtocol {
+		info.Protocol = goldSourceMinProtocol
+	}
+
+	return info, rd.err
+}
+
+func lowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
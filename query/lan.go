@@ -0,0 +1,172 @@
+package query
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/hfern/goseq"
+	"net"
+	"time"
+)
+
+// DiscoverLAN broadcasts A2S_INFO to every target, as the in-game LAN
+// browser does, and sends each server that answers within window once.
+// The channel is closed when the window ends or ctx is done.
+func DiscoverLAN(ctx context.Context, targets []*net.UDPAddr, window time.Duration) (<-chan Result, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request := append(a2sRequest(a2sInfoRequest), a2sInfoPayload...)
+
+	// Some interfaces refuse broadcasts; only give up if every one did.
+	var sendErr error
+	sent := 0
+	for _, dest := range targets {
+		if _, err := conn.WriteToUDP(request, dest); err != nil {
+			sendErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 && sendErr != nil {
+		conn.Close()
+		return nil, sendErr
+	}
+
+	deadline := time.Now().Add(window)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	results := make(chan Result)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(results)
+		defer conn.Close()
+		defer close(stop)
+		collectLanReplies(ctx, conn, request, deadline, results)
+	}()
+
+	// Unblock the read as soon as ctx is cancelled.
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	return results, nil
+}
+
+// collectLanReplies reads A2S_INFO replies until the deadline, answering
+// challenges as they come in. Each server is reported once.
+func collectLanReplies(ctx context.Context, conn *net.UDPConn, request []byte, deadline time.Time, send chan<- Result) {
+	conn.SetReadDeadline(deadline)
+
+	seen := make(map[string]bool)
+	buf := make([]byte, a2sMaxPacketSize)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The deadline ends the window.
+			return
+		}
+		if n < 5 || int32(binary.LittleEndian.Uint32(buf[:4])) != a2sSinglePacket {
+			continue
+		}
+
+		addr := from.String()
+		kind, data := buf[4], buf[5:n]
+
+		if kind == a2sChallengeResponse && len(data) >= 4 {
+			conn.WriteToUDP(append(append([]byte(nil), request...), data[:4]...), from)
+			continue
+		}
+
+		if seen[addr] {
+			continue
+		}
+
+		info, err := parseInfo(kind, data)
+		if err != nil {
+			continue
+		}
+		seen[addr] = true
+
+		server := goseq.NewServer()
+		if err := server.SetAddress(addr); err != nil {
+			continue
+		}
+
+		select {
+		case send <- Result{Server: server, Info: info}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// BroadcastAddresses lists the IPv4 broadcast address of every address on
+// the named interface, or on every broadcast-capable interface that is up.
+func BroadcastAddresses(name string) ([]net.IP, error) {
+	var ifaces []net.Interface
+
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		ifaces = all
+	}
+
+	broadcasts := make([]net.IP, 0)
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			mask := ipnet.Mask
+			if len(mask) == net.IPv6len {
+				mask = mask[12:]
+			}
+			if ip == nil || len(mask) != net.IPv4len {
+				continue
+			}
+
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				bcast[i] = ip[i] | ^mask[i]
+			}
+			broadcasts = append(broadcasts, bcast)
+		}
+	}
+
+	if len(broadcasts) == 0 {
+		return nil, errors.New("No IPv4 broadcast-capable interfaces found. Try --interface.")
+	}
+
+	return broadcasts, nil
+}
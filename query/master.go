@@ -0,0 +1,156 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hfern/goseq"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Regions maps the region codes the CLI accepts to master server regions.
+var Regions = map[string]goseq.Region{
+	"USE":   goseq.USEast,
+	"USW":   goseq.USWest,
+	"SA":    goseq.SouthAmerica,
+	"EU":    goseq.Europe,
+	"AS":    goseq.Asia,
+	"AU":    goseq.Australia,
+	"ME":    goseq.MiddleEast,
+	"AF":    goseq.Africa,
+	"OTHER": goseq.RestOfWorld,
+}
+
+func masterAddr(opts MasterOptions) string {
+	if opts.Master == "" {
+		return DefaultMaster
+	}
+	return opts.Master
+}
+
+// The master server protocol; see
+// https://developer.valvesoftware.com/wiki/Master_Server_Query_Protocol
+const (
+	masterQueryRequest byte = 0x31
+	masterNoAddress         = "0.0.0.0:0"
+	masterEntrySize         = 6
+
+	// Most pages read for one listing, so a master that never sends the
+	// terminating address can't keep us reading forever.
+	masterMaxPages = 1000
+)
+
+var (
+	masterReplyHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x66, 0x0A}
+
+	errMasterBadReply = errors.New("Master server sent a malformed reply.")
+)
+
+// queryMasterList asks the master server for the servers in the region
+// matching the filters, starting after opts.Start when it is set. Each page
+// of the listing must arrive within timeout; ctx aborts the listing.
+func queryMasterList(ctx context.Context, opts MasterOptions, timeout time.Duration) ([]goseq.Server, error) {
+	region, found := Regions[strings.ToUpper(opts.Region)]
+
+	if !found {
+		return nil, fmt.Errorf("Region '%s' does not exist.", opts.Region)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", masterAddr(opts))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer a2sWatch(ctx, conn)()
+
+	start := masterNoAddress
+	if opts.Start != "" {
+		start = opts.Start
+	}
+	filter := masterFilter(opts.Filters)
+
+	servers := make([]goseq.Server, 0)
+	buf := make([]byte, a2sMaxPacketSize)
+
+	for page := 0; page < masterMaxPages; page++ {
+		request := append([]byte{masterQueryRequest, byte(region)}, start...)
+		request = append(append(request, 0), filter...)
+		request = append(request, 0)
+
+		if _, err := conn.Write(request); err != nil {
+			return nil, a2sContextErr(ctx, err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, a2sContextErr(ctx, err)
+		}
+
+		addrs, err := parseMasterReply(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return servers, nil
+		}
+
+		for _, addr := range addrs {
+			if addr == masterNoAddress {
+				return servers, nil
+			}
+			server := goseq.NewServer()
+			if err := server.SetAddress(addr); err != nil {
+				return nil, err
+			}
+			servers = append(servers, server)
+		}
+
+		// The next page continues after the last address of this one.
+		start = addrs[len(addrs)-1]
+	}
+
+	return servers, nil
+}
+
+// masterFilter encodes filters as \name\value pairs, in name order so
+// the same filters always make the same request.
+func masterFilter(filters map[string]string) string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var filter strings.Builder
+	for _, name := range names {
+		filter.WriteString("\\" + name + "\\" + filters[name])
+	}
+	return filter.String()
+}
+
+// parseMasterReply reads the ip:port entries of one page of a listing.
+func parseMasterReply(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(data, masterReplyHeader) {
+		return nil, errMasterBadReply
+	}
+	data = data[len(masterReplyHeader):]
+	if len(data)%masterEntrySize != 0 {
+		return nil, errMasterBadReply
+	}
+
+	addrs := make([]string, 0, len(data)/masterEntrySize)
+	for ; len(data) > 0; data = data[masterEntrySize:] {
+		ip := net.IPv4(data[0], data[1], data[2], data[3])
+		port := binary.BigEndian.Uint16(data[4:6])
+		addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,183 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Printer renders a stream of results. Init is called first, then Run in
+// its own goroutine until in is closed, then Done.
+type Printer interface {
+	Init(fields []FieldSpec, in <-chan Result)
+	Run() // calls with go Run()
+	Done()
+}
+
+// PrinterOptions tune how a Printer lays out its output. Formats ignore
+// the options that don't apply to them.
+type PrinterOptions struct {
+	Divider  string // between fields
+	MaxWidth int    // cut lines to this many cells; 0 for no limit
+	Theme    Theme  // colours; nil for none
+}
+
+// PrinterFactory makes a Printer writing to out.
+type PrinterFactory func(out io.Writer, opts PrinterOptions) Printer
+
+var printers = map[string]PrinterFactory{
+	"text":     func(out io.Writer, opts PrinterOptions) Printer { return &textWriter{out: out, opts: opts} },
+	"json":     func(out io.Writer, opts PrinterOptions) Printer { return &jsonWriter{out: out} },
+	"table":    newTableWriter,
+	"markdown": func(out io.Writer, opts PrinterOptions) Printer { return &reportWriter{out: out} },
+	"html":     func(out io.Writer, opts PrinterOptions) Printer { return &reportWriter{out: out, html: true} },
+}
+
+// RegisterPrinter makes a format available to NewPrinter.
+func RegisterPrinter(format string, factory PrinterFactory) {
+	printers[format] = factory
+}
+
+// PrinterFormats lists the registered format names.
+func PrinterFormats() []string {
+	formats := make([]string, 0, len(printers))
+	for format := range printers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// NewPrinter returns the writer for an output format name; "" is text.
+func NewPrinter(format string, out io.Writer, opts PrinterOptions) (Printer, error) {
+	if format == "" {
+		format = "text"
+	}
+	if factory, ok := printers[format]; ok {
+		return factory(out, opts), nil
+	}
+	return nil, fmt.Errorf("Unknown output format '%s'.", format)
+}
+
+// StartPrinter runs w over in. The returned channel is closed once in has
+// been closed and drained, after which w.Done() may be called.
+func StartPrinter(w Printer, fields []FieldSpec, in <-chan Result) <-chan struct{} {
+	finished := make(chan struct{})
+	w.Init(fields, in)
+	go func() {
+		w.Run()
+		close(finished)
+	}()
+	return finished
+}
+
+type textWriter struct {
+	out    io.Writer
+	fields []FieldSpec
+	in     <-chan Result
+	opts   PrinterOptions
+}
+
+func (w *textWriter) Init(fields []FieldSpec, in <-chan Result) {
+	w.fields = fields
+	w.in = in
+}
+
+func (w *textWriter) Run() {
+	var line strings.Builder
+	for sv := range w.in {
+		line.Reset()
+		for i, field := range w.fields {
+			if i > 0 {
+				line.WriteString(w.opts.Divider)
+			}
+			style := rowStyle(w.opts.Theme, sv).With(cellStyle(w.opts.Theme, sv, field.Name))
+			text := style.Wrap(cellText(sv, field.Name))
+			line.WriteString(PadText(text, field.Length, fieldAlign(field.Name)))
+		}
+		fmt.Fprintln(w.out, fitLine(line.String(), w.opts.MaxWidth))
+	}
+}
+
+func (w *textWriter) Done() {}
+
+// cellText is a field of sv as text output shows it, cleaned of control
+// characters.
+func cellText(sv Result, name string) string {
+	val := FieldValue(sv, name)
+
+	// Precomputed values are already in their text form.
+	if sv.Values != nil {
+		return CleanText(fmt.Sprint(val))
+	}
+	return CleanText(FieldText(name, val))
+}
+
+func fieldAlign(name string) Alignment {
+	if field, ok := fieldIndex[name]; ok {
+		return field.Align
+	}
+	return AlignLeft
+}
+
+// fitLine cuts line to maxWidth cells, if there is a limit. Padding at the
+// end of a line is dropped first.
+func fitLine(line string, maxWidth int) string {
+	if maxWidth <= 0 || DisplayWidth(line) <= maxWidth {
+		return line
+	}
+	line = strings.TrimRight(line, " ")
+	return Truncate(line, maxWidth)
+}
+
+type jsonWriter struct {
+	out     io.Writer
+	fields  []FieldSpec
+	in      <-chan Result
+	servers []map[string]interface{}
+}
+
+func (w *jsonWriter) Init(fields []FieldSpec, in <-chan Result) {
+	w.fields = fields
+	w.in = in
+	w.servers = make([]map[string]interface{}, 0)
+}
+
+func (w *jsonWriter) Run() {
+	for sv := range w.in {
+		w.servers = append(w.servers, Record(sv, w.fields))
+	}
+}
+
+func (w *jsonWriter) Done() {
+	text, err := json.Marshal(w.servers)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprint(w.out, string(text))
+}
+
+// Record is the object the JSON printer writes for one result. Results
+// served from a cache carry their age in seconds as CacheAge.
+func Record(sv Result, fields []FieldSpec) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		val := FieldValue(sv, field.Name)
+		if def, ok := fieldIndex[field.Name]; ok && sv.Values == nil {
+			val = def.FormatJSON(val)
+		}
+		record[field.Name] = val
+	}
+	if sv.Age > 0 {
+		record["CacheAge"] = AgeSeconds(sv.Age)
+	}
+	return record
+}
+
+// AgeSeconds is how cache ages appear in JSON output.
+func AgeSeconds(age time.Duration) float64 {
+	return float64(age/time.Millisecond) / 1000
+}
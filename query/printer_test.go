@@ -0,0 +1,217 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/hfern/goseq"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServer(addr string) goseq.Server {
+	server := goseq.NewServer()
+	server.SetAddress(addr)
+	return server
+}
+
+// printerRows are two answering servers, one with markup and an escape
+// sequence in its name, and one that didn't answer.
+func printerRows() []Result {
+	return []Result{
+		{Server: testServer("203.0.113.7:27015"), Ping: 35 * time.Millisecond,
+			Info: goseq.ServerInfo{Name: "Alpha | <One>", Map: "cp_badlands", Players: 20, MaxPlayers: 24}},
+		{Server: testServer("198.51.100.9:27016"), Ping: 80 * time.Millisecond,
+			Info: goseq.ServerInfo{Name: "Beta\x1b[31m", Map: "ctf_2fort", Players: 3, MaxPlayers: 32}},
+		{Server: testServer("198.51.100.9:27016"), Err: errors.New("i/o timeout")},
+	}
+}
+
+// printRows runs the named printer over rows and returns what it wrote.
+func printRows(t *testing.T, format, fieldSpec string, opts PrinterOptions, rows []Result) string {
+	t.Helper()
+
+	fields, err := ParseFields(fieldSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer, err := NewPrinter(format, &out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan Result)
+	finished := StartPrinter(printer, fields, in)
+	for _, row := range rows {
+		in <- row
+	}
+	close(in)
+	<-finished
+	printer.Done()
+
+	return out.String()
+}
+
+func checkOutput(t *testing.T, format, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s output:\n%s\nwant:\n%s", format, got, want)
+	}
+}
+
+func TestTextPrinter(t *testing.T) {
+	got := printRows(t, "text", "ip,name=10,players,ping", PrinterOptions{Divider: " | "}, printerRows())
+	checkOutput(t, "text", got, ""+
+		"203.0.113.7:27015     | Alpha | <One> |  20 |   35\n"+
+		"198.51.100.9:27016    | Beta       |   3 |   80\n"+
+		"198.51.100.9:27016    |            |   0 |    0\n")
+}
+
+func TestTextPrinterMaxWidth(t *testing.T) {
+	got := printRows(t, "text", "ip,map", PrinterOptions{Divider: " ", MaxWidth: 25}, printerRows()[:2])
+	checkOutput(t, "text", got, ""+
+		"203.0.113.7:27015     cp…\n"+
+		"198.51.100.9:27016    ct…\n")
+}
+
+func TestTextPrinterTheme(t *testing.T) {
+	theme := Theme{RoleUnreachable: "2"}
+	got := printRows(t, "text", "ip=18", PrinterOptions{Theme: theme}, printerRows()[1:])
+	checkOutput(t, "text", got, ""+
+		"198.51.100.9:27016\n"+
+		"\x1b[2m198.51.100.9:27016\x1b[0m\n")
+}
+
+func TestTextPrinterLeavesUnqueriedUnstyled(t *testing.T) {
+	theme := Theme{RoleReachable: "32", RoleEmpty: "2"}
+	rows := []Result{{Server: testServer("203.0.113.7:27015"), Unqueried: true}}
+	got := printRows(t, "text", "ip=17", PrinterOptions{Theme: theme}, rows)
+	checkOutput(t, "text", got, "203.0.113.7:27015\n")
+}
+
+func TestJSONPrinter(t *testing.T) {
+	rows := printerRows()
+	rows[0].Age = 1500 * time.Millisecond
+	got := printRows(t, "json", "ip,name,players,ping", PrinterOptions{}, rows)
+
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &records); err != nil {
+		t.Fatalf("%s: %s", err, got)
+	}
+
+	want := []map[string]interface{}{
+		{"ip": "203.0.113.7:27015", "name": "Alpha | <One>", "players": 20.0, "ping": 35.0, "CacheAge": 1.5},
+		{"ip": "198.51.100.9:27016", "name": "Beta\x1b[31m", "players": 3.0, "ping": 80.0},
+		{"ip": "198.51.100.9:27016", "name": "", "players": 0.0, "ping": 0.0},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("json output %v, want %v", records, want)
+	}
+}
+
+func TestTablePrinter(t *testing.T) {
+	got := printRows(t, "table", "ip,name=10,players,ping", PrinterOptions{}, printerRows())
+	checkOutput(t, "table", got, ""+
+		"┌────────────────────┬───────────────┬─────┬────────┐\n"+
+		"│ IP Addr            │ Name          │ Ply │ Ping   │\n"+
+		"├────────────────────┼───────────────┼─────┼────────┤\n"+
+		"│ 203.0.113.7:27015  │ Alpha | <One> │  20 │     35 │\n"+
+		"│ 198.51.100.9:27016 │ Beta          │   3 │     80 │\n"+
+		"│ 198.51.100.9:27016 │               │   0 │      0 │\n"+
+		"├────────────────────┼───────────────┼─────┼────────┤\n"+
+		"│ 3 servers          │               │  23 │ avg 58 │\n"+
+		"└────────────────────┴───────────────┴─────┴────────┘\n")
+}
+
+func TestTablePrinterShrinksToMaxWidth(t *testing.T) {
+	got := printRows(t, "table", "name,players", PrinterOptions{MaxWidth: 17}, printerRows()[:2])
+	checkOutput(t, "table", got, ""+
+		"┌─────────┬─────┐\n"+
+		"│ Name    │ Ply │\n"+
+		"├─────────┼─────┤\n"+
+		"│ Alpha … │  20 │\n"+
+		"│ Beta    │   3 │\n"+
+		"├─────────┼─────┤\n"+
+		"│ 2 serv… │  23 │\n"+
+		"└─────────┴─────┘\n")
+}
+
+func TestMarkdownPrinter(t *testing.T) {
+	got := printRows(t, "markdown", "ip,name,players", PrinterOptions{}, printerRows())
+	checkOutput(t, "markdown", got, ""+
+		"| IP Addr | Name | Ply |\n"+
+		"|---|---|--:|\n"+
+		"| 203.0.113.7:27015 | Alpha \\| &lt;One> | 20 |\n"+
+		"| 198.51.100.9:27016 | Beta | 3 |\n"+
+		"| 198.51.100.9:27016 |   | 0 |\n")
+}
+
+func TestHTMLPrinter(t *testing.T) {
+	got := printRows(t, "html", "ip,name,players", PrinterOptions{}, printerRows())
+
+	for _, want := range []string{
+		"<!DOCTYPE html>\n",
+		"<th>IP Addr</th>\n<th>Name</th>\n<th>Ply</th>\n",
+		"<tr><td>203.0.113.7:27015</td><td>Alpha | &lt;One&gt;</td><td class=\"num\">20</td></tr>\n",
+		"<tr><td>198.51.100.9:27016</td><td>Beta</td><td class=\"num\">3</td></tr>\n",
+		"</script>\n</body>\n</html>\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("html output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\x1b") {
+		t.Error("html output has an escape sequence")
+	}
+}
+
+func TestWriteHTMLTableSortKeys(t *testing.T) {
+	var out bytes.Buffer
+	rows := [][]string{{"Scout", "1h2m0s"}, {"Heavy", "5m0s"}}
+	sortKeys := [][]string{{"", "3720"}, {"", "300"}}
+	WriteHTMLTable(&out, []string{"Name", "Time"}, rows, sortKeys, []Alignment{AlignLeft, AlignLeft})
+
+	got := out.String()
+	for _, want := range []string{
+		"<tr><td>Scout</td><td data-sort=\"3720\">1h2m0s</td></tr>\n",
+		"<tr><td>Heavy</td><td data-sort=\"300\">5m0s</td></tr>\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("html table lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestTemplatePrinterKeepsError(t *testing.T) {
+	// The unreachable row refers to a field that doesn't exist.
+	tmpl, err := ParseTemplate("{{.map}}{{if .Error}}{{.nosuch}}{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printer := NewTemplatePrinter(&out, tmpl)
+	in := make(chan Result)
+	finished := StartPrinter(printer, nil, in)
+	for _, row := range printerRows() {
+		in <- row
+	}
+	close(in)
+	<-finished
+	printer.Done()
+
+	checkOutput(t, "template", out.String(), "cp_badlands\nctf_2fort\n")
+	if printer.Err() == nil {
+		t.Error("Template printer didn't keep the rendering error")
+	}
+}
+
+func TestNewPrinterUnknownFormat(t *testing.T) {
+	if _, err := NewPrinter("yaml", &bytes.Buffer{}, PrinterOptions{}); err == nil {
+		t.Error("NewPrinter accepted an unknown format")
+	}
+}
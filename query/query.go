@@ -0,0 +1,441 @@
+// Package query talks to Source and GoldSource game servers and to Valve's
+// master servers, and formats what they report.
+//
+// QueryMaster lists and probes every server a master server knows about;
+// QueryServer fetches the info, players and rules of one server. A Client
+// carries the timeout, cache and concurrency settings both use, and
+// DefaultClient backs the package-level functions.
+package query
+
+import (
+	"context"
+	"github.com/hfern/goseq"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Player is satisfied by goseq's players and by our own A2S_PLAYER rows.
+type Player interface {
+	Index() int
+	Name() string
+	Score() int
+	Duration() time.Duration
+}
+
+type MaybePlayers struct {
+	Error   error
+	Players []Player
+
+	// Filled in from RCON status when enabled; Details parallels Players
+	// and is nil where no status row matched.
+	RconError error
+	Details   []*RconPlayer
+
+	// Age is how old a cached result is; 0 when freshly queried.
+	Age time.Duration
+}
+
+type MaybeInfo struct {
+	Error error
+	Info  goseq.ServerInfo
+	Age   time.Duration
+}
+
+type MaybeRules struct {
+	Error error
+	Rules goseq.RuleMap
+	Age   time.Duration
+}
+
+// Attributes is everything QueryServer learned about one server.
+type Attributes struct {
+	Address  string
+	Resolved string
+	Engine   string
+	Players  MaybePlayers
+	Info     MaybeInfo
+	Rules    MaybeRules
+}
+
+// Result views the attributes as a Result so a server query can be handed
+// to a Printer. An address that doesn't resolve fails the result unless the
+// info query already did.
+func (a Attributes) Result() Result {
+	err := a.Info.Error
+	server := goseq.NewServer()
+	if addrErr := server.SetAddress(a.Resolved); addrErr != nil && err == nil {
+		err = addrErr
+	}
+	return Result{
+		Err:     err,
+		Server:  server,
+		Info:    a.Info.Info,
+		Age:     a.Info.Age,
+		Players: a.Players.Players,
+		Rules:   a.Rules.Rules,
+	}
+}
+
+// What selects the parts of a server QueryServer asks for.
+type What uint
+
+const (
+	Info What = 1 << iota
+	Players
+	Rules
+
+	All = Info | Players | Rules
+)
+
+// Answered tells whether any of the parts in what came back.
+func (a Attributes) Answered(what What) bool {
+	return what&Info != 0 && a.Info.Error == nil ||
+		what&Players != 0 && a.Players.Error == nil ||
+		what&Rules != 0 && a.Rules.Error == nil
+}
+
+// Result is one server from a master query, or one precomputed row (see
+// Values) handed to a Printer.
+type Result struct {
+	Err    error
+	Server goseq.Server
+	Info   goseq.ServerInfo
+	Ping   time.Duration
+	Age    time.Duration // of a cached info reply; 0 when fresh
+
+	// Unqueried marks a server taken from a master listing as is, whose
+	// info was never asked for.
+	Unqueried bool
+
+	// Players and Rules are only filled in for server queries.
+	Players []Player
+	Rules   goseq.RuleMap
+
+	// Values, when set, holds precomputed field values (e.g. grouped
+	// rows) and replaces the accessors.
+	Values map[string]interface{}
+}
+
+// Cache stores successful query results. Fetch fills value from the cache
+// when it can and otherwise runs query, caching what it fills in; it
+// returns the age of a cached value, or 0 for a fresh one.
+type Cache interface {
+	Fetch(key string, value interface{}, query func() error) (time.Duration, error)
+}
+
+// MasterOptions picks the master server listing QueryMaster works on.
+type MasterOptions struct {
+	Region  string
+	Master  string // host:port, DefaultMaster when empty
+	Start   string // address to continue the listing after
+	Filters map[string]string
+
+	// Exclude, when set, drops servers from the listing before any of
+	// them is queried.
+	Exclude func(addr string) bool
+}
+
+const DefaultMaster = "hl2master.steampowered.com:27011"
+
+// Client holds the settings queries run with. Timeout applies to each
+// request sent and must be set; DefaultClient uses two seconds.
+type Client struct {
+	Timeout time.Duration
+
+	// Cache, when set, is consulted before every info, players, rules and
+	// master list query.
+	Cache Cache
+
+	// RconPassword, when set, enriches the player list from RCON status.
+	RconPassword string
+
+	// Serial makes QueryServer ask for one attribute at a time and
+	// QueryServers probe one server at a time.
+	Serial bool
+
+	// Parallel caps how many servers QueryServers probes at once; 0 means
+	// all of them.
+	Parallel int
+}
+
+var DefaultClient = &Client{Timeout: 2 * time.Second}
+
+// QueryServer queries addr with DefaultClient.
+func QueryServer(ctx context.Context, addr string, what What) (Attributes, error) {
+	return DefaultClient.QueryServer(ctx, addr, what)
+}
+
+// QueryMaster queries a master server listing with DefaultClient.
+func QueryMaster(ctx context.Context, opts MasterOptions) <-chan Result {
+	return DefaultClient.QueryMaster(ctx, opts)
+}
+
+// QueryServer fetches the selected attributes of the first server addr
+// resolves to. Failures of individual queries are reported in the
+// attributes; the error is only for addresses that don't resolve.
+func (c *Client) QueryServer(ctx context.Context, addr string, what What) (Attributes, error) {
+	resolved, err := ResolveServerAddress(addr, true)
+	if err != nil {
+		return Attributes{}, err
+	}
+
+	attrs := Attributes{Address: resolved[0].Input, Resolved: resolved[0].Addr}
+	c.queryAttributes(ctx, &attrs, what)
+	return attrs, ctx.Err()
+}
+
+func (c *Client) queryAttributes(ctx context.Context, attrs *Attributes, what What) {
+	addr := attrs.Resolved
+
+	// The info reply tells us the engine, which decides the split-packet
+	// format of the rules and players replies, so it has to come first,
+	// even when only rules or players were asked for.
+	attrs.Engine = EngineSource
+	if what&(Info|Rules|Players) != 0 {
+		var info MaybeInfo
+		info.Info, _, info.Age, info.Error = c.info(ctx, addr)
+		if info.Error == nil {
+			attrs.Engine = infoEngine(info.Info)
+		}
+		if what&Info != 0 {
+			attrs.Info = info
+		}
+	}
+	goldSource := attrs.Engine == EngineGoldSource
+	status := MaybeRconStatus{}
+
+	calls := make([]func(), 0, 3)
+	if what&Rules != 0 {
+		calls = append(calls, func() {
+			attrs.Rules.Rules, attrs.Rules.Age, attrs.Rules.Error = c.rules(ctx, addr, goldSource)
+		})
+	}
+	if what&Players != 0 {
+		calls = append(calls, func() {
+			attrs.Players.Players, attrs.Players.Age, attrs.Players.Error = c.players(ctx, addr, goldSource)
+		})
+		if c.RconPassword != "" {
+			calls = append(calls, func() {
+				status = rconStatus(addr, c.RconPassword, c.Timeout)
+			})
+		}
+	}
+
+	done := make(chan struct{})
+	started := 0
+	for _, call := range calls {
+		if ctx.Err() != nil {
+			break
+		}
+		if c.Serial {
+			call()
+			continue
+		}
+		started++
+		go func(call func()) {
+			call()
+			done <- struct{}{}
+		}(call)
+	}
+	for ; started > 0; started-- {
+		<-done
+	}
+
+	if what&Players != 0 && c.RconPassword != "" {
+		mergeRconStatus(&attrs.Players, status)
+	}
+}
+
+// QueryMaster lists the servers the master server knows about and sends
+// the A2S_INFO result of each as it arrives. A failed listing is sent as
+// a single Result with Err set. The channel is closed when done.
+func (c *Client) QueryMaster(ctx context.Context, opts MasterOptions) <-chan Result {
+	servers, _, err := c.MasterList(ctx, opts)
+	if err != nil {
+		results := make(chan Result, 1)
+		results <- Result{Err: err}
+		close(results)
+		return results
+	}
+	return c.QueryServers(ctx, servers)
+}
+
+// MasterList asks the master server for its listing and returns the
+// servers in it, along with the listing's age when it came from the cache.
+func (c *Client) MasterList(ctx context.Context, opts MasterOptions) ([]goseq.Server, time.Duration, error) {
+	var addrs []string
+
+	age, err := c.fetch(masterCacheKey(opts), &addrs, func() error {
+		servers, err := queryMasterList(ctx, opts, c.Timeout)
+		if err != nil {
+			return err
+		}
+		addrs = make([]string, len(servers))
+		for i, server := range servers {
+			addrs[i] = server.Address()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	servers := make([]goseq.Server, 0, len(addrs))
+	for _, addr := range addrs {
+		if opts.Exclude != nil && opts.Exclude(addr) {
+			continue
+		}
+		server := goseq.NewServer()
+		if err := server.SetAddress(addr); err != nil {
+			return nil, 0, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, age, ctx.Err()
+}
+
+// QueryServers sends the A2S_INFO result of every server as it arrives and
+// closes the channel once all are in or ctx is done.
+func (c *Client) QueryServers(ctx context.Context, servers []goseq.Server) <-chan Result {
+	results := make(chan Result)
+
+	parallel := c.Parallel
+	if c.Serial {
+		parallel = 1
+	}
+	if parallel <= 0 || parallel > len(servers) {
+		parallel = len(servers)
+	}
+
+	go func() {
+		defer close(results)
+
+		slots := make(chan struct{}, parallel)
+		done := make(chan struct{})
+
+		started := 0
+		for _, server := range servers {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			started++
+
+			go func(server goseq.Server) {
+				defer func() { <-slots; done <- struct{}{} }()
+				select {
+				case results <- c.QueryInfo(ctx, server):
+				case <-ctx.Done():
+				}
+			}(server)
+		}
+
+		for ; started > 0; started-- {
+			<-done
+		}
+	}()
+
+	return results
+}
+
+// QueryInfo fetches one server's A2S_INFO, timing the round trip. A cached
+// reply comes with the ping measured when it was fetched.
+func (c *Client) QueryInfo(ctx context.Context, server goseq.Server) Result {
+	info, ping, age, err := c.info(ctx, server.Address())
+	if err != nil {
+		return Result{Err: err, Server: server}
+	}
+	return Result{Server: server, Info: info, Ping: ping, Age: age}
+}
+
+func (c *Client) fetch(key string, value interface{}, query func() error) (time.Duration, error) {
+	if c.Cache == nil {
+		return 0, query()
+	}
+	return c.Cache.Fetch(key, value, query)
+}
+
+// cachedInfo keeps the round trip with the reply, so a cached answer
+// reports the ping it was fetched with rather than the time to read it.
+type cachedInfo struct {
+	goseq.ServerInfo
+	Ping time.Duration
+}
+
+func (c *Client) info(ctx context.Context, addr string) (goseq.ServerInfo, time.Duration, time.Duration, error) {
+	var info cachedInfo
+	age, err := c.fetch("info|"+addr, &info, func() (err error) {
+		sent := time.Now()
+		info.ServerInfo, err = A2SInfo(ctx, addr, c.Timeout)
+		info.Ping = time.Since(sent)
+		return err
+	})
+	return info.ServerInfo, info.Ping, age, err
+}
+
+// engineCacheKey keys rules and players by engine as well as address, as
+// the engine decides how their replies are read.
+func engineCacheKey(kind, addr string, goldSource bool) string {
+	engine := EngineSource
+	if goldSource {
+		engine = EngineGoldSource
+	}
+	return kind + "|" + engine + "|" + addr
+}
+
+func (c *Client) rules(ctx context.Context, addr string, goldSource bool) (goseq.RuleMap, time.Duration, error) {
+	var rules goseq.RuleMap
+	age, err := c.fetch(engineCacheKey("rules", addr, goldSource), &rules, func() (err error) {
+		rules, err = A2SRules(ctx, addr, goldSource, c.Timeout)
+		return err
+	})
+	return rules, age, err
+}
+
+type cachedPlayer struct {
+	Index    int
+	Name     string
+	Score    int
+	Duration time.Duration
+}
+
+func (c *Client) players(ctx context.Context, addr string, goldSource bool) ([]Player, time.Duration, error) {
+	var rows []cachedPlayer
+	age, err := c.fetch(engineCacheKey("players", addr, goldSource), &rows, func() error {
+		players, err := A2SPlayers(ctx, addr, goldSource, c.Timeout)
+		if err != nil {
+			return err
+		}
+		rows = make([]cachedPlayer, len(players))
+		for i, player := range players {
+			rows[i] = cachedPlayer{player.Index(), player.Name(), player.Score(), player.Duration()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	players := make([]Player, len(rows))
+	for i, row := range rows {
+		players[i] = a2sPlayer{index: row.Index, name: row.Name, score: row.Score, duration: row.Duration}
+	}
+	return players, age, nil
+}
+
+// masterCacheKey covers everything that shapes a listing: master, region,
+// start address and filters.
+func masterCacheKey(opts MasterOptions) string {
+	filters := make([]string, 0, len(opts.Filters))
+	for name, value := range opts.Filters {
+		filters = append(filters, name+"="+value)
+	}
+	sort.Strings(filters)
+
+	return strings.Join([]string{"master", masterAddr(opts), strings.ToUpper(opts.Region),
+		opts.Start, strings.Join(filters, "&")}, "|")
+}
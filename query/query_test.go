@@ -0,0 +1,392 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubServer is a game server on loopback that answers A2S_INFO,
+// A2S_PLAYER and A2S_RULES, asking for a challenge first as current
+// servers do. A silent one never answers.
+type stubServer struct {
+	conn   *net.UDPConn
+	silent bool
+}
+
+var stubChallenge = []byte{0x0A, 0x0B, 0x0C, 0x0D}
+
+func startStubServer(t *testing.T, silent bool) *stubServer {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &stubServer{conn: conn, silent: silent}
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *stubServer) serve() {
+	buf := make([]byte, a2sMaxPacketSize)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if s.silent || n < 5 {
+			continue
+		}
+		if reply := stubReply(buf[4], buf[5:n]); reply != nil {
+			s.conn.WriteToUDP(reply, from)
+		}
+	}
+}
+
+// stubReply answers one request: with a challenge until the request
+// carries it, then with the reply.
+func stubReply(kind byte, payload []byte) []byte {
+	challenged := bytes.HasSuffix(payload, stubChallenge)
+
+	var body []byte
+	switch kind {
+	case a2sInfoRequest:
+		body = stubInfo()
+	case a2sPlayerRequest:
+		body = stubPlayers()
+	case a2sRulesRequest:
+		body = stubRules()
+	default:
+		return nil
+	}
+	if !challenged {
+		body = append([]byte{a2sChallengeResponse}, stubChallenge...)
+	}
+	return append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, body...)
+}
+
+func stubInfo() []byte {
+	info := []byte{a2sInfoResponse, 17}
+	for _, s := range []string{"Stub Server", "cp_badlands", "tf", "Team Fortress"} {
+		info = append(append(info, s...), 0)
+	}
+	info = binary.LittleEndian.AppendUint16(info, 440)
+	info = append(info, 5, 24, 1, 'd', 'l', 0, 1)
+	info = append(append(info, "1.0.0.0"...), 0)
+	info = append(info, 0x80)
+	return binary.LittleEndian.AppendUint16(info, 27015)
+}
+
+func stubPlayers() []byte {
+	players := []byte{a2sPlayerResponse, 2}
+	for i, name := range []string{"Scout", "Heavy"} {
+		players = append(players, byte(i))
+		players = append(append(players, name...), 0)
+		players = binary.LittleEndian.AppendUint32(players, uint32(10*(i+1)))
+		players = binary.LittleEndian.AppendUint32(players, math.Float32bits(90))
+	}
+	return players
+}
+
+func stubRules() []byte {
+	rules := binary.LittleEndian.AppendUint16([]byte{a2sRulesResponse}, 2)
+	for _, s := range []string{"mp_timelimit", "30", "sv_cheats", "0"} {
+		rules = append(append(rules, s...), 0)
+	}
+	return rules
+}
+
+// closedAddr is a loopback address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func testClient() *Client {
+	return &Client{Timeout: time.Second}
+}
+
+func TestQueryServer(t *testing.T) {
+	server := startStubServer(t, false)
+
+	attrs, err := testClient().QueryServer(context.Background(), server.addr(), All)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attrs.Resolved != server.addr() || attrs.Engine != EngineSource {
+		t.Errorf("Resolved %s (%s), want %s (Source)", attrs.Resolved, attrs.Engine, server.addr())
+	}
+
+	if attrs.Info.Error != nil {
+		t.Fatal(attrs.Info.Error)
+	}
+	info := attrs.Info.Info
+	if info.GetName() != "Stub Server" || info.GetMap() != "cp_badlands" || ToInt(info.GetPlayers()) != 5 ||
+		ToInt(info.GetMaxPlayers()) != 24 || ToInt(info.GetPort()) != 27015 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	if attrs.Players.Error != nil {
+		t.Fatal(attrs.Players.Error)
+	}
+	if len(attrs.Players.Players) != 2 {
+		t.Fatalf("Got %d players, want 2", len(attrs.Players.Players))
+	}
+	heavy := attrs.Players.Players[1]
+	if heavy.Name() != "Heavy" || heavy.Score() != 20 || heavy.Duration() != 90*time.Second {
+		t.Errorf("Unexpected player %s/%d/%s", heavy.Name(), heavy.Score(), heavy.Duration())
+	}
+
+	if attrs.Rules.Error != nil {
+		t.Fatal(attrs.Rules.Error)
+	}
+	if attrs.Rules.Rules["mp_timelimit"] != "30" || attrs.Rules.Rules["sv_cheats"] != "0" {
+		t.Errorf("Unexpected rules %v", attrs.Rules.Rules)
+	}
+}
+
+func TestQueryServerLeavesOutInfo(t *testing.T) {
+	server := startStubServer(t, false)
+
+	attrs, err := testClient().QueryServer(context.Background(), server.addr(), Rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Info.Info.GetName() != "" || attrs.Players.Players != nil {
+		t.Errorf("Got sections that weren't asked for: %+v", attrs)
+	}
+	if len(attrs.Rules.Rules) != 2 {
+		t.Errorf("Got rules %v", attrs.Rules.Rules)
+	}
+}
+
+func TestQueryServerCancel(t *testing.T) {
+	server := startStubServer(t, true)
+	client := &Client{Timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	attrs, err := client.QueryServer(ctx, server.addr(), Info)
+	if err != context.Canceled {
+		t.Errorf("Got error %v, want %v", err, context.Canceled)
+	}
+	if attrs.Info.Error != context.Canceled {
+		t.Errorf("Got info error %v, want %v", attrs.Info.Error, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Cancelling took %s", elapsed)
+	}
+}
+
+// stubMaster is a master server on loopback that lists servers two to a
+// page, recording the requests it gets.
+type stubMaster struct {
+	conn    *net.UDPConn
+	servers []string
+
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+func startStubMaster(t *testing.T, servers []string) *stubMaster {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	m := &stubMaster{conn: conn, servers: append(servers, masterNoAddress)}
+	go m.serve()
+	return m
+}
+
+func (m *stubMaster) serve() {
+	buf := make([]byte, a2sMaxPacketSize)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		request := append([]byte(nil), buf[:n]...)
+		m.mu.Lock()
+		m.requests = append(m.requests, request)
+		m.mu.Unlock()
+
+		// The page starts after the address the request continues from.
+		start := string(request[2 : 2+bytes.IndexByte(request[2:], 0)])
+		first := 0
+		for i, addr := range m.servers[:len(m.servers)-1] {
+			if addr == start {
+				first = i + 1
+			}
+		}
+		last := first + 2
+		if last > len(m.servers) {
+			last = len(m.servers)
+		}
+
+		reply := append([]byte(nil), masterReplyHeader...)
+		for _, addr := range m.servers[first:last] {
+			host, port, _ := net.SplitHostPort(addr)
+			portNum, _ := strconv.Atoi(port)
+			reply = append(reply, net.ParseIP(host).To4()...)
+			reply = binary.BigEndian.AppendUint16(reply, uint16(portNum))
+		}
+		m.conn.WriteToUDP(reply, from)
+	}
+}
+
+func TestQueryMaster(t *testing.T) {
+	up := startStubServer(t, false)
+	down := closedAddr(t)
+	other := startStubServer(t, false)
+	master := startStubMaster(t, []string{up.addr(), down, other.addr()})
+
+	opts := MasterOptions{
+		Region:  "eu",
+		Master:  master.conn.LocalAddr().String(),
+		Filters: map[string]string{"map": "cp_badlands", "gamedir": "tf"},
+	}
+
+	answered := make(map[string]string)
+	failed := make(map[string]error)
+	for sv := range testClient().QueryMaster(context.Background(), opts) {
+		if sv.Server == nil {
+			t.Fatal(sv.Err)
+		}
+		if sv.Err != nil {
+			failed[sv.Server.Address()] = sv.Err
+			continue
+		}
+		answered[sv.Server.Address()] = sv.Info.GetName()
+	}
+
+	if len(answered) != 2 || answered[up.addr()] != "Stub Server" || answered[other.addr()] != "Stub Server" {
+		t.Errorf("Answered: %v", answered)
+	}
+	if len(failed) != 1 || failed[down] == nil {
+		t.Errorf("Failed: %v", failed)
+	}
+
+	// Two pages, the second continuing after the last address of the first.
+	master.mu.Lock()
+	defer master.mu.Unlock()
+	if len(master.requests) != 2 {
+		t.Fatalf("Master got %d requests, want 2", len(master.requests))
+	}
+	first := string(master.requests[0])
+	want := "\x31" + string([]byte{byte(Regions["EU"])}) + "0.0.0.0:0\x00\\gamedir\\tf\\map\\cp_badlands\x00"
+	if first != want {
+		t.Errorf("First request %q, want %q", first, want)
+	}
+	if !bytes.HasPrefix(master.requests[1][2:], []byte(down+"\x00")) {
+		t.Errorf("Second request %q doesn't continue after %s", master.requests[1], down)
+	}
+}
+
+func TestQueryMasterBadRegion(t *testing.T) {
+	results := testClient().QueryMaster(context.Background(), MasterOptions{Region: "MARS"})
+	sv := <-results
+	if sv.Err == nil || sv.Server != nil {
+		t.Fatalf("Got %+v, want a failed listing", sv)
+	}
+	if _, open := <-results; open {
+		t.Error("Channel not closed after a failed listing")
+	}
+}
+
+func TestQueryMasterCancel(t *testing.T) {
+	silent := startStubServer(t, true)
+	client := &Client{Timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := client.MasterList(ctx, MasterOptions{Region: "EU", Master: silent.addr()})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Cancelling took %s", elapsed)
+	}
+}
+
+func TestAttributesAnswered(t *testing.T) {
+	failed := errors.New("i/o timeout")
+	rulesOnly := Attributes{Info: MaybeInfo{Error: failed}, Players: MaybePlayers{Error: failed}}
+	tests := []struct {
+		attrs Attributes
+		what  What
+		want  bool
+	}{
+		{Attributes{}, All, true},
+		{Attributes{Info: MaybeInfo{Error: failed}}, Info, false},
+		{Attributes{Info: MaybeInfo{Error: failed}}, Info | Players, true},
+		{rulesOnly, Info | Players, false},
+		{rulesOnly, All, true},
+		{Attributes{}, 0, false},
+	}
+
+	for _, test := range tests {
+		if got := test.attrs.Answered(test.what); got != test.want {
+			t.Errorf("Answered(%b) of %+v = %t, want %t", test.what, test.attrs, got, test.want)
+		}
+	}
+}
+
+func TestDiscoverLAN(t *testing.T) {
+	server := startStubServer(t, false)
+	target, err := net.ResolveUDPAddr("udp4", server.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+
+	results, err := DiscoverLAN(context.Background(), []*net.UDPAddr{target}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for sv := range results {
+		found = append(found, sv.Server.Address()+" "+sv.Info.GetName())
+	}
+	if len(found) != 1 || found[0] != server.addr()+" Stub Server" {
+		t.Errorf("Found %v", found)
+	}
+
+	// Nothing is left waiting on a context that is never cancelled.
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines left running", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
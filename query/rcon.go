@@ -0,0 +1,181 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Source RCON over TCP.
+// See https://developer.valvesoftware.com/wiki/Source_RCON_Protocol
+
+const (
+	rconResponseValue int32 = 0
+	rconExecCommand   int32 = 2
+	rconAuthResponse  int32 = 2
+	rconAuth          int32 = 3
+
+	// id, type and the two terminating nulls.
+	rconPacketOverhead = 10
+	rconMaxPacketSize  = 4096 + rconPacketOverhead
+)
+
+var (
+	errRconAuthFailed = errors.New("RCON authentication failed. Check the password.")
+	errRconBadPacket  = errors.New("RCON server sent a malformed packet.")
+)
+
+type rconPacket struct {
+	id   int32
+	kind int32
+	body string
+}
+
+type RconClient struct {
+	conn    net.Conn
+	rd      *bufio.Reader
+	timeout time.Duration
+	lastID  int32
+}
+
+// DialRcon connects to addr and authenticates with password.
+func DialRcon(addr, password string, timeout time.Duration) (*RconClient, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, a2sDefaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &RconClient{
+		conn:    conn,
+		rd:      bufio.NewReader(conn),
+		timeout: timeout,
+	}
+
+	if err := client.auth(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c *RconClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *RconClient) auth(password string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	id := c.newID()
+	if err := c.writePacket(id, rconAuth, password); err != nil {
+		return err
+	}
+
+	// Servers send an empty RESPONSE_VALUE ahead of the AUTH_RESPONSE.
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if packet.kind != rconAuthResponse {
+			continue
+		}
+		if packet.id != id {
+			return errRconAuthFailed
+		}
+		return nil
+	}
+}
+
+// Exec runs command and returns its whole output. Responses may span many
+// packets with no end marker, so an empty RESPONSE_VALUE is sent right after
+// the command: the server mirrors it back once the real output is done.
+func (c *RconClient) Exec(command string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	id := c.newID()
+	terminator := c.newID()
+
+	if err := c.writePacket(id, rconExecCommand, command); err != nil {
+		return "", err
+	}
+	if err := c.writePacket(terminator, rconResponseValue, ""); err != nil {
+		return "", err
+	}
+
+	var output bytes.Buffer
+
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return output.String(), err
+		}
+
+		switch packet.id {
+		case id:
+			output.WriteString(packet.body)
+			c.conn.SetDeadline(time.Now().Add(c.timeout))
+		case terminator:
+			return output.String(), nil
+		}
+		// Anything else is left over from an earlier terminator.
+	}
+}
+
+func (c *RconClient) newID() int32 {
+	c.lastID++
+	return c.lastID
+}
+
+func (c *RconClient) writePacket(id, kind int32, body string) error {
+	size := int32(len(body) + rconPacketOverhead)
+	buf := bytes.NewBuffer(make([]byte, 0, size+4))
+
+	binary.Write(buf, binary.LittleEndian, size)
+	binary.Write(buf, binary.LittleEndian, id)
+	binary.Write(buf, binary.LittleEndian, kind)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+func (c *RconClient) readPacket() (rconPacket, error) {
+	var size int32
+	if err := binary.Read(c.rd, binary.LittleEndian, &size); err != nil {
+		return rconPacket{}, err
+	}
+	if size < rconPacketOverhead || size > rconMaxPacketSize {
+		return rconPacket{}, errRconBadPacket
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.rd, data); err != nil {
+		return rconPacket{}, err
+	}
+
+	return rconPacket{
+		id:   int32(binary.LittleEndian.Uint32(data[0:4])),
+		kind: int32(binary.LittleEndian.Uint32(data[4:8])),
+		body: string(bytes.TrimRight(data[8:], "\x00")),
+	}, nil
+}
+
+// RconExec connects, runs one command and disconnects.
+func RconExec(addr, password, command string, timeout time.Duration) (string, error) {
+	client, err := DialRcon(addr, password, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	return client.Exec(command)
+}
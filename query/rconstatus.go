@@ -0,0 +1,221 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RconPlayer is one row of the RCON `status` player table.
+type RconPlayer struct {
+	UserID    int
+	Name      string
+	SteamID   string
+	Connected string
+	Ping      int
+	Loss      int
+	State     string
+	Address   string
+}
+
+type MaybeRconStatus struct {
+	Error   error
+	Players []RconPlayer
+}
+
+// parseRconStatus reads the player table out of `status` output. Both the
+// Source layout ("# userid name uniqueid connected ping loss state adr",
+// with an optional rate column) and the CS2 layout ("id time ping loss
+// state rate adr name") are understood; columns are located by header.
+func parseRconStatus(output string) []RconPlayer {
+	players := make([]RconPlayer, 0)
+	var columns []string
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "#end" {
+			break
+		}
+
+		tokens := tokenizeStatusLine(strings.TrimPrefix(line, "#"))
+
+		if columns == nil {
+			if isStatusHeader(tokens) {
+				columns = make([]string, len(tokens))
+				for i, tok := range tokens {
+					columns[i] = tok.text
+				}
+			}
+			continue
+		}
+
+		if ply, ok := parseStatusRow(columns, tokens); ok {
+			players = append(players, ply)
+		}
+	}
+
+	return players
+}
+
+type statusToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeStatusLine splits on whitespace, keeping "double" and 'single'
+// quoted names whole.
+func tokenizeStatusLine(line string) []statusToken {
+	tokens := make([]statusToken, 0)
+
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.LastIndexByte(line, c)
+			if end <= i {
+				end = len(line)
+			}
+			tokens = append(tokens, statusToken{text: line[i+1 : end], quoted: true})
+			i = end + 1
+		default:
+			end := strings.IndexAny(line[i:], " \t")
+			if end < 0 {
+				end = len(line) - i
+			}
+			tokens = append(tokens, statusToken{text: line[i : i+end]})
+			i += end
+		}
+	}
+
+	return tokens
+}
+
+func isStatusHeader(tokens []statusToken) bool {
+	has := make(map[string]bool, len(tokens))
+	for _, tok := range tokens {
+		has[tok.text] = true
+	}
+	return has["name"] && has["ping"] && (has["userid"] || has["id"])
+}
+
+func parseStatusRow(columns []string, tokens []statusToken) (RconPlayer, bool) {
+	nameAt := -1
+	for i, tok := range tokens {
+		if tok.quoted {
+			nameAt = i
+			break
+		}
+	}
+
+	nameCol := indexOf(columns, "name")
+	if nameAt < 0 || nameCol < 0 || nameAt == 0 {
+		return RconPlayer{}, false
+	}
+
+	values := make(map[string]string, len(columns))
+
+	// Before the name, align from the left; CS:GO adds an unlisted slot
+	// number after the userid, which lands on no column and is dropped.
+	values[columns[0]] = tokens[0].text
+	before := tokens[1:nameAt]
+	if len(before) == nameCol-1 {
+		for i, tok := range before {
+			values[columns[i+1]] = tok.text
+		}
+	}
+
+	// After the name, align from the left too. Bots only list their
+	// uniqueid and state, so a short row keeps just the first and last.
+	after := tokens[nameAt+1:]
+	afterCols := columns[nameCol+1:]
+	if len(after) >= len(afterCols) {
+		for i, col := range afterCols {
+			values[col] = after[i].text
+		}
+	} else if len(after) > 0 && len(afterCols) > 0 {
+		values[afterCols[0]] = after[0].text
+		values["state"] = after[len(after)-1].text
+	}
+
+	userID, err := strconv.Atoi(firstNonEmpty(values["userid"], values["id"]))
+	if err != nil || tokens[nameAt].text == "" || values["state"] == "challenging" {
+		return RconPlayer{}, false
+	}
+
+	ply := RconPlayer{
+		UserID:    userID,
+		Name:      tokens[nameAt].text,
+		SteamID:   values["uniqueid"],
+		Connected: firstNonEmpty(values["connected"], values["time"]),
+		State:     values["state"],
+		Address:   values["adr"],
+	}
+	ply.Ping, _ = strconv.Atoi(values["ping"])
+	ply.Loss, _ = strconv.Atoi(values["loss"])
+
+	return ply, true
+}
+
+// mergeRconStatus attaches status rows to A2S players, matching by name and
+// falling back to userid when A2S reports a non-zero index.
+func mergeRconStatus(players *MaybePlayers, status MaybeRconStatus) {
+	players.RconError = status.Error
+	if status.Error != nil {
+		return
+	}
+
+	players.Details = make([]*RconPlayer, len(players.Players))
+	used := make([]bool, len(status.Players))
+
+	match := func(same func(RconPlayer) bool) *RconPlayer {
+		for j := range status.Players {
+			if !used[j] && same(status.Players[j]) {
+				used[j] = true
+				return &status.Players[j]
+			}
+		}
+		return nil
+	}
+
+	for i, ply := range players.Players {
+		name := ply.Name()
+		players.Details[i] = match(func(r RconPlayer) bool { return r.Name == name })
+	}
+
+	for i, ply := range players.Players {
+		index := ply.Index()
+		if players.Details[i] != nil || index == 0 {
+			continue
+		}
+		players.Details[i] = match(func(r RconPlayer) bool { return r.UserID == index })
+	}
+}
+
+// rconStatus runs status over RCON and parses its player table.
+func rconStatus(addr, password string, timeout time.Duration) MaybeRconStatus {
+	output, err := RconExec(addr, password, "status", timeout)
+	if err != nil {
+		return MaybeRconStatus{Error: err}
+	}
+	return MaybeRconStatus{Players: parseRconStatus(output)}
+}
+
+func indexOf(list []string, want string) int {
+	for i, s := range list {
+		if s == want {
+			return i
+		}
+	}
+	return -1
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
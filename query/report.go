@@ -0,0 +1,153 @@
+package query
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// reportWriter holds every row back and writes them as one markdown or
+// HTML table, titled with the field headers.
+type reportWriter struct {
+	out    io.Writer
+	html   bool
+	fields []FieldSpec
+	in     <-chan Result
+	rows   [][]string
+}
+
+func (w *reportWriter) Init(fields []FieldSpec, in <-chan Result) {
+	w.fields = fields
+	w.in = in
+	w.rows = make([][]string, 0)
+}
+
+func (w *reportWriter) Run() {
+	for sv := range w.in {
+		row := make([]string, len(w.fields))
+		for i, field := range w.fields {
+			row[i] = cellText(sv, field.Name)
+		}
+		w.rows = append(w.rows, row)
+	}
+}
+
+func (w *reportWriter) Done() {
+	header := make([]string, len(w.fields))
+	aligns := make([]Alignment, len(w.fields))
+	for i, field := range w.fields {
+		header[i] = FieldTitle(field.Name)
+		aligns[i] = fieldAlign(field.Name)
+	}
+
+	if !w.html {
+		WriteMarkdownTable(w.out, header, w.rows, aligns)
+		return
+	}
+
+	WriteHTMLStart(w.out, "Servers")
+	WriteHTMLTable(w.out, header, w.rows, nil, aligns)
+	WriteHTMLEnd(w.out)
+}
+
+// MarkdownText escapes text for a markdown table cell.
+func MarkdownText(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;").Replace(text)
+	if text == "" {
+		return " "
+	}
+	return text
+}
+
+// WriteMarkdownTable writes a GitHub-flavoured markdown table.
+func WriteMarkdownTable(out io.Writer, header []string, rows [][]string, aligns []Alignment) {
+	rule := make([]string, len(header))
+	for i := range header {
+		rule[i] = "---"
+		if aligns[i] == AlignRight {
+			rule[i] = "--:"
+		}
+	}
+
+	markdownRow(out, header)
+	fmt.Fprintln(out, "|"+strings.Join(rule, "|")+"|")
+	for _, row := range rows {
+		markdownRow(out, row)
+	}
+}
+
+func markdownRow(out io.Writer, cells []string) {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = MarkdownText(cell)
+	}
+	fmt.Fprintln(out, "| "+strings.Join(escaped, " | ")+" |")
+}
+
+// htmlStyle and htmlScript make the page stand alone: clicking a column
+// header sorts the table by it, numerically when the column is numbers.
+// A cell's data-sort attribute, when set, is sorted on instead of its text.
+const htmlStyle = `body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; }
+th { background: #eee; cursor: pointer; }
+td.num { text-align: right; }
+.error { color: #b00; }`
+
+const htmlScript = `document.querySelectorAll("table.sortable th").forEach(function (th) {
+	th.addEventListener("click", function () {
+		var table = th.closest("table"), body = table.tBodies[0];
+		var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+		var asc = th.dataset.order !== "asc";
+		th.dataset.order = asc ? "asc" : "desc";
+		var rows = Array.prototype.slice.call(body.rows);
+		var key = function (cell) { return cell.dataset.sort !== undefined ? cell.dataset.sort : cell.textContent; };
+		rows.sort(function (a, b) {
+			var x = key(a.cells[col]), y = key(b.cells[col]);
+			var d = (x !== "" && y !== "" && !isNaN(x) && !isNaN(y)) ? x - y : x.localeCompare(y);
+			return asc ? d : -d;
+		});
+		rows.forEach(function (row) { body.appendChild(row); });
+	});
+});`
+
+// WriteHTMLStart opens a self-contained HTML page.
+func WriteHTMLStart(out io.Writer, title string) {
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n",
+		html.EscapeString(title), htmlStyle)
+}
+
+// WriteHTMLEnd closes a page opened by WriteHTMLStart.
+func WriteHTMLEnd(out io.Writer) {
+	fmt.Fprintf(out, "<script>\n%s\n</script>\n</body>\n</html>\n", htmlScript)
+}
+
+// WriteHTMLTable writes a table whose columns sort when their header is
+// clicked. Cells are escaped. sortKeys, if not nil, parallels rows and gives
+// the value a cell sorts by where its text doesn't, such as seconds for a
+// duration; empty keys are left out.
+func WriteHTMLTable(out io.Writer, header []string, rows [][]string, sortKeys [][]string, aligns []Alignment) {
+	fmt.Fprintln(out, "<table class=\"sortable\">\n<thead>\n<tr>")
+	for _, title := range header {
+		fmt.Fprintf(out, "<th>%s</th>\n", html.EscapeString(title))
+	}
+	fmt.Fprintln(out, "</tr>\n</thead>\n<tbody>")
+
+	for r, row := range rows {
+		fmt.Fprint(out, "<tr>")
+		for i, cell := range row {
+			attrs := ""
+			if aligns[i] == AlignRight {
+				attrs += " class=\"num\""
+			}
+			if sortKeys != nil && sortKeys[r][i] != "" {
+				attrs += fmt.Sprintf(" data-sort=\"%s\"", html.EscapeString(sortKeys[r][i]))
+			}
+			fmt.Fprintf(out, "<td%s>%s</td>", attrs, html.EscapeString(cell))
+		}
+		fmt.Fprintln(out, "</tr>")
+	}
+
+	fmt.Fprintln(out, "</tbody>\n</table>")
+}
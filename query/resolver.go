@@ -0,0 +1,113 @@
+package query
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ResolvedAddress pairs what the user typed with one IP:port it stands for.
+type ResolvedAddress struct {
+	Input string
+	Addr  string
+}
+
+// ResolveServerAddress expands a user supplied server address into the
+// IP:port pairs to query. It accepts IPv4 and IPv6 literals (bracketed when
+// a port is given), hostnames with any number of A/AAAA records, and SRV
+// names such as _source._udp.example.org. With firstOnly set only the first
+// address of each name is kept.
+func ResolveServerAddress(input string, firstOnly bool) ([]ResolvedAddress, error) {
+	host, port, err := splitServerAddress(input)
+	if err != nil {
+		return nil, err
+	}
+
+	type target struct {
+		host string
+		port string
+	}
+
+	targets := []target{{host, port}}
+
+	if strings.HasPrefix(host, "_") {
+		_, srvs, err := net.LookupSRV("", "", host)
+		if err != nil {
+			return nil, err
+		}
+		targets = targets[:0]
+		for _, srv := range srvs {
+			targets = append(targets, target{
+				host: strings.TrimSuffix(srv.Target, "."),
+				port: strconv.Itoa(int(srv.Port)),
+			})
+		}
+	}
+
+	resolved := make([]ResolvedAddress, 0, len(targets))
+	seen := make(map[string]bool)
+
+	for _, t := range targets {
+		ips, err := LookupServerIPs(t.host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip.String(), t.port)
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			resolved = append(resolved, ResolvedAddress{Input: input, Addr: addr})
+
+			if firstOnly {
+				return resolved, nil
+			}
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, &net.DNSError{Err: "no addresses found", Name: input, IsNotFound: true}
+	}
+
+	return resolved, nil
+}
+
+// splitServerAddress separates host and port, defaulting the port. Bare
+// IPv6 literals are accepted without brackets when no port is given.
+func splitServerAddress(input string) (host, port string, err error) {
+	input = strings.TrimSpace(input)
+
+	if input == "" {
+		return "", "", errors.New("Empty server address.")
+	}
+
+	if ip := net.ParseIP(input); ip != nil {
+		return input, a2sDefaultPort, nil
+	}
+
+	if strings.HasPrefix(input, "[") && strings.HasSuffix(input, "]") {
+		return input[1 : len(input)-1], a2sDefaultPort, nil
+	}
+
+	host, port, err = net.SplitHostPort(input)
+	if err != nil {
+		if strings.Contains(input, ":") {
+			return "", "", err
+		}
+		return input, a2sDefaultPort, nil
+	}
+
+	return host, port, nil
+}
+
+// LookupServerIPs returns the IPs of a host, or the host itself when it's
+// already an IP literal.
+func LookupServerIPs(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	return net.LookupIP(host)
+}
@@ -0,0 +1,209 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// tableWriter holds every row back, then draws a bordered table with each
+// column as wide as its widest value and a footer of totals.
+type tableWriter struct {
+	out    io.Writer
+	opts   PrinterOptions
+	fields []FieldSpec
+	in     <-chan Result
+	rows   []Result
+}
+
+func newTableWriter(out io.Writer, opts PrinterOptions) Printer {
+	return &tableWriter{out: out, opts: opts}
+}
+
+func (w *tableWriter) Init(fields []FieldSpec, in <-chan Result) {
+	w.fields = fields
+	w.in = in
+	w.rows = make([]Result, 0)
+}
+
+func (w *tableWriter) Run() {
+	for sv := range w.in {
+		w.rows = append(w.rows, sv)
+	}
+}
+
+func (w *tableWriter) Done() {
+	header := make([]string, len(w.fields))
+	for i, field := range w.fields {
+		header[i] = FieldTitle(field.Name)
+	}
+
+	cells := make([][]string, len(w.rows))
+	for r, sv := range w.rows {
+		cells[r] = make([]string, len(w.fields))
+		for i, field := range w.fields {
+			cells[r][i] = cellText(sv, field.Name)
+		}
+	}
+
+	footer := w.totals()
+	aligns := w.aligns(cells)
+
+	widths := make([]int, len(w.fields))
+	for _, row := range append([][]string{header, footer}, cells...) {
+		for i, cell := range row {
+			if n := DisplayWidth(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	w.shrink(widths, aligns)
+
+	w.border(widths, "┌", "┬", "┐")
+	w.row(widths, header, func(i int) Style { return w.opts.Theme[RoleHeader] }, nil)
+	w.border(widths, "├", "┼", "┤")
+	for r, row := range cells {
+		sv := w.rows[r]
+		w.row(widths, row, func(i int) Style {
+			return rowStyle(w.opts.Theme, sv).With(cellStyle(w.opts.Theme, sv, w.fields[i].Name))
+		}, aligns)
+	}
+	w.border(widths, "├", "┼", "┤")
+	w.row(widths, footer, func(i int) Style { return w.opts.Theme[RoleHeader] }, aligns)
+	w.border(widths, "└", "┴", "┘")
+}
+
+// aligns right-aligns numeric columns: registered fields say whether they
+// are, and other columns, such as --agg results, are if all their values
+// are numbers.
+func (w *tableWriter) aligns(cells [][]string) []Alignment {
+	aligns := make([]Alignment, len(w.fields))
+	for i, field := range w.fields {
+		if _, ok := fieldIndex[field.Name]; ok {
+			aligns[i] = fieldAlign(field.Name)
+			continue
+		}
+		aligns[i] = AlignRight
+		for _, row := range cells {
+			if _, err := strconv.ParseFloat(row[i], 64); err != nil {
+				aligns[i] = AlignLeft
+				break
+			}
+		}
+	}
+	return aligns
+}
+
+// shrink narrows the widest text columns until the table fits MaxWidth.
+func (w *tableWriter) shrink(widths []int, aligns []Alignment) {
+	if w.opts.MaxWidth <= 0 {
+		return
+	}
+
+	// Each column takes its width plus a space either side and a border.
+	total := 1
+	for _, width := range widths {
+		total += width + 3
+	}
+
+	for total > w.opts.MaxWidth {
+		widest := -1
+		for i, width := range widths {
+			if aligns[i] == AlignLeft && width > 3 && (widest < 0 || width > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+func (w *tableWriter) border(widths []int, left, middle, right string) {
+	parts := make([]string, len(widths))
+	for i, width := range widths {
+		parts[i] = strings.Repeat("─", width+2)
+	}
+	fmt.Fprintln(w.out, left+strings.Join(parts, middle)+right)
+}
+
+// row draws one line of cells, left-aligned when aligns is nil.
+func (w *tableWriter) row(widths []int, cells []string, style func(i int) Style, aligns []Alignment) {
+	parts := make([]string, len(cells))
+	for i, cell := range cells {
+		align := AlignLeft
+		if aligns != nil {
+			align = aligns[i]
+		}
+		cell = Truncate(cell, widths[i])
+		parts[i] = " " + PadText(style(i).Wrap(cell), widths[i], align) + " "
+	}
+	fmt.Fprintln(w.out, "│"+strings.Join(parts, "│")+"│")
+}
+
+// totals is the footer: the number of servers in the first column, unless
+// that column has a total of its own, and each column's total.
+func (w *tableWriter) totals() []string {
+	footer := make([]string, len(w.fields))
+
+	answered := 0
+	for _, sv := range w.rows {
+		if sv.Err == nil {
+			answered++
+		}
+	}
+
+	for i, field := range w.fields {
+		total := columnTotal(field.Name)
+		if total == NoTotal {
+			continue
+		}
+
+		sum := 0.0
+		for _, sv := range w.rows {
+			if sv.Err == nil {
+				sum += toFloat(FieldValue(sv, field.Name))
+			}
+		}
+
+		if total == TotalAvg {
+			if answered > 0 {
+				footer[i] = "avg " + strconv.Itoa(int(sum/float64(answered)+0.5))
+			}
+			continue
+		}
+		footer[i] = strconv.FormatFloat(sum, 'f', -1, 64)
+	}
+
+	if len(footer) > 0 && footer[0] == "" {
+		what := "servers"
+		if len(w.rows) > 0 && w.rows[0].Values != nil {
+			what = "groups"
+		}
+		footer[0] = fmt.Sprintf("%d %s", len(w.rows), what)
+	}
+
+	return footer
+}
+
+// columnTotal is how a column is totalled: by its field, or for --agg
+// columns of grouped rows, counts and sums add up.
+func columnTotal(name string) Total {
+	if field, ok := fieldIndex[name]; ok {
+		return field.Total
+	}
+	if name == "count" || strings.HasPrefix(name, "sum(") {
+		return TotalSum
+	}
+	return NoTotal
+}
+
+func toFloat(val interface{}) float64 {
+	if f, ok := val.(float64); ok {
+		return f
+	}
+	return float64(ToInt(val))
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFuncs is the function library --template text can use.
+var TemplateFuncs = template.FuncMap{
+	"trunc":         trunc,
+	"pad":           func(width int, val interface{}) string { return PadText(fmt.Sprint(val), width, AlignLeft) },
+	"padLeft":       func(width int, val interface{}) string { return PadText(fmt.Sprint(val), width, AlignRight) },
+	"upper":         func(val interface{}) string { return strings.ToUpper(fmt.Sprint(val)) },
+	"humanDuration": humanDuration,
+	"json":          jsonText,
+}
+
+// ParseTemplate parses --template text. Each result is rendered with a map
+// of every field by name, plus Error, Players and Rules.
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("template").Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse template: %s", err)
+	}
+	return tmpl, nil
+}
+
+// NewTemplatePrinter renders tmpl once per result, each on its own line.
+func NewTemplatePrinter(out io.Writer, tmpl *template.Template) *TemplatePrinter {
+	return &TemplatePrinter{out: out, tmpl: tmpl}
+}
+
+// TemplatePrinter is the Printer for --template. Results the template
+// fails on are skipped; Err reports the first failure once it's done.
+type TemplatePrinter struct {
+	out  io.Writer
+	tmpl *template.Template
+	in   <-chan Result
+	err  error
+}
+
+func (w *TemplatePrinter) Init(fields []FieldSpec, in <-chan Result) {
+	w.in = in
+}
+
+func (w *TemplatePrinter) Run() {
+	var buf strings.Builder
+	for sv := range w.in {
+		buf.Reset()
+		if err := w.tmpl.Execute(&buf, TemplateData(sv)); err != nil {
+			// Keep the first failure only; it is likely the same for all.
+			if w.err == nil {
+				w.err = fmt.Errorf("Couldn't render template: %s", err)
+			}
+			continue
+		}
+		if !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteString("\n")
+		}
+		io.WriteString(w.out, buf.String())
+	}
+}
+
+func (w *TemplatePrinter) Done() {}
+
+// Err is the first error rendering a result, if any. Call it after Done.
+func (w *TemplatePrinter) Err() error {
+	return w.err
+}
+
+// TemplateData is what a template sees for one result: every field by
+// name, with coded fields such as environment in their text form, and
+// Error, Players and Rules. Players and Rules are only set by server
+// queries.
+func TemplateData(sv Result) map[string]interface{} {
+	data := make(map[string]interface{}, len(fieldList)+3)
+
+	if sv.Values != nil {
+		for name, val := range sv.Values {
+			data[name] = val
+		}
+		return data
+	}
+
+	for _, field := range fieldList {
+		val := field.Value(sv)
+		if field.Type == EnumField {
+			val = field.FormatText(val)
+		}
+		data[field.Name] = val
+	}
+
+	data["Error"] = ""
+	if sv.Err != nil {
+		data["Error"] = sv.Err.Error()
+	}
+	players := make([]templatePlayer, len(sv.Players))
+	for i, player := range sv.Players {
+		players[i] = templatePlayer{player.Index(), player.Name(), player.Score(), player.Duration()}
+	}
+	data["Players"] = players
+	data["Rules"] = sv.Rules
+
+	return data
+}
+
+type templatePlayer struct {
+	Index    int
+	Name     string
+	Score    int
+	Duration time.Duration
+}
+
+// trunc cuts val to at most width cells, ending with an ellipsis when
+// anything was cut.
+func trunc(width int, val interface{}) string {
+	return Truncate(fmt.Sprint(val), width)
+}
+
+// humanDuration prints a duration, or a number of seconds, like 1h05m or
+// 3m20s.
+func humanDuration(val interface{}) string {
+	var d time.Duration
+	switch t := val.(type) {
+	case time.Duration:
+		d = t
+	default:
+		d = time.Duration(ToInt(val)) * time.Second
+	}
+
+	d = d.Truncate(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", d/time.Minute, d%time.Minute/time.Second)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+func jsonText(val interface{}) (string, error) {
+	text, err := json.Marshal(val)
+	return string(text), err
+}
@@ -0,0 +1,163 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges are the East Asian Wide and Fullwidth blocks, plus the emoji
+// blocks terminals draw two cells wide.
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1},
+		{0x231a, 0x231b, 1},
+		{0x2329, 0x232a, 1},
+		{0x23e9, 0x23ec, 1},
+		{0x25fd, 0x25fe, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x26aa, 0x26ab, 1},
+		{0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1},
+		{0x26f2, 0x26f5, 1},
+		{0x2705, 0x270a, 5},
+		{0x2728, 0x274c, 36},
+		{0x2753, 0x2755, 1},
+		{0x2795, 0x2797, 1},
+		{0x2b1b, 0x2b1c, 1},
+		{0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1},
+		{0x3400, 0x4dbf, 1},
+		{0x4e00, 0x9fff, 1},
+		{0xa000, 0xa4cf, 1},
+		{0xa960, 0xa97f, 1},
+		{0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1},
+		{0xfe10, 0xfe19, 1},
+		{0xfe30, 0xfe6f, 1},
+		{0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x18cff, 1},
+		{0x1b000, 0x1b2ff, 1},
+		{0x1f004, 0x1f0cf, 203},
+		{0x1f18e, 0x1f191, 3},
+		{0x1f192, 0x1f19a, 1},
+		{0x1f200, 0x1f251, 1},
+		{0x1f300, 0x1f64f, 1},
+		{0x1f680, 0x1f6ff, 1},
+		{0x1f7e0, 0x1f7eb, 1},
+		{0x1f90c, 0x1f9ff, 1},
+		{0x1fa70, 0x1faff, 1},
+		{0x20000, 0x2fffd, 1},
+		{0x30000, 0x3fffd, 1},
+	},
+}
+
+// RuneWidth is the number of terminal cells r takes: 0 for combining marks
+// and other zero-width runes, 2 for wide ones, 1 otherwise.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0x200d || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r):
+		return 0
+	case r >= 0xfe00 && r <= 0xfe0f: // variation selectors
+		return 0
+	case unicode.IsControl(r):
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	}
+	return 1
+}
+
+// DisplayWidth is the number of terminal cells text takes. Escape
+// sequences, such as colours, take none.
+func DisplayWidth(text string) int {
+	if strings.IndexByte(text, '\x1b') >= 0 {
+		text = _escaperegexp.ReplaceAllString(text, "")
+	}
+
+	width := 0
+	for _, r := range text {
+		width += RuneWidth(r)
+	}
+	return width
+}
+
+// Truncate cuts text to at most width cells, ending it with an ellipsis
+// when anything was cut. Escape sequences are kept, and styling is reset
+// after the ellipsis.
+func Truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if DisplayWidth(text) <= width {
+		return text
+	}
+
+	var cut strings.Builder
+	escapes := _escaperegexp.FindAllStringIndex(text, -1)
+	used := 0
+
+	for i := 0; i < len(text); {
+		if len(escapes) > 0 && escapes[0][0] == i {
+			cut.WriteString(text[i:escapes[0][1]])
+			i = escapes[0][1]
+			escapes = escapes[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		w := RuneWidth(r)
+		if used+w > width-1 {
+			break
+		}
+		cut.WriteRune(r)
+		used += w
+		i += size
+	}
+
+	cut.WriteString("…")
+	if strings.IndexByte(cut.String(), '\x1b') >= 0 {
+		cut.WriteString(ansiReset)
+	}
+	return cut.String()
+}
+
+// PadText widens text to width cells with spaces on the side align calls
+// for.
+func PadText(text string, width int, align Alignment) string {
+	n := width - DisplayWidth(text)
+	if n <= 0 {
+		return text
+	}
+	if align == AlignRight {
+		return strings.Repeat(" ", n) + text
+	}
+	return text + strings.Repeat(" ", n)
+}
+
+var _escaperegexp = regexp.MustCompile("\x1b(\\[[0-?]*[ -/]*[@-~]|\\][^\x07\x1b]*(\x07|\x1b\\\\)?|[@-_])")
+
+// CleanText removes the terminal escape sequences and control characters
+// servers sometimes put in names, so they can't move the cursor or
+// recolour the output. Tabs and newlines become spaces.
+func CleanText(text string) string {
+	if strings.IndexFunc(text, unicode.IsControl) < 0 {
+		return text
+	}
+
+	text = _escaperegexp.ReplaceAllString(text, "")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+}
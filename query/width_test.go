@@ -0,0 +1,90 @@
+package query
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+	}{
+		{"", 0},
+		{"de_dust2", 8},
+		{"日本語", 6},
+		{"🎮 game", 7},
+		{"é", 1},
+		{"\x1b[1;33mbold\x1b[0m", 4},
+		{"\x1b[38;2;255;0;0m红\x1b[0m", 2},
+		{"\x1b]0;title\x07name", 4},
+		{"\x1b]8;;https://example.org\x1b\\link\x1b]8;;\x1b\\", 4},
+		{"tab\there", 7},
+	}
+
+	for _, test := range tests {
+		if got := DisplayWidth(test.text); got != test.width {
+			t.Errorf("DisplayWidth(%q) = %d, want %d", test.text, got, test.width)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"much too long", 8, "much to…"},
+		{"anything", 0, ""},
+		{"anything", 1, "…"},
+		// A wide rune that doesn't fit whole is left out.
+		{"日本語の名前", 6, "日本…"},
+		// Escape sequences are kept and don't count, and the style is
+		// reset after the ellipsis.
+		{"\x1b[31mred server name\x1b[0m", 6, "\x1b[31mred s…" + ansiReset},
+		{"ab\x1b[1mcdef\x1b[0m", 5, "ab\x1b[1mcd…" + ansiReset},
+		{"\x1b[1mfits\x1b[0m", 4, "\x1b[1mfits\x1b[0m"},
+	}
+
+	for _, test := range tests {
+		got := Truncate(test.text, test.width)
+		if got != test.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+		if DisplayWidth(got) > test.width {
+			t.Errorf("Truncate(%q, %d) is %d cells wide", test.text, test.width, DisplayWidth(got))
+		}
+	}
+}
+
+func TestPadText(t *testing.T) {
+	if got := PadText("\x1b[1m12\x1b[0m", 4, AlignRight); got != "  \x1b[1m12\x1b[0m" {
+		t.Errorf("Right-aligned %q", got)
+	}
+	if got := PadText("名前", 6, AlignLeft); got != "名前  " {
+		t.Errorf("Left-aligned %q", got)
+	}
+	if got := PadText("too wide", 3, AlignLeft); got != "too wide" {
+		t.Errorf("Overflowing %q", got)
+	}
+}
+
+func TestCleanText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"\x1b[2J\x1b[Hcleared", "cleared"},
+		{"\x1b]0;pwned\x07Server", "Server"},
+		{"multi\nline\ttab", "multi line tab"},
+		{"bell\x07 and \x00nul", "bell and nul"},
+		{"名前 🎮", "名前 🎮"},
+	}
+
+	for _, test := range tests {
+		if got := CleanText(test.text); got != test.want {
+			t.Errorf("CleanText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
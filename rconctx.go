@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RconOptions struct {
+	PasswordFile string `long:"password-file" short:"p" default:"" description:"File holding the RCON password. Defaults to $SOURCEQ_RCON_PASSWORD."`
+	AddressFile  string `long:"file" short:"F" default:"" description:"Run the command on every server in this file, one per line ('-' for StdIn)."`
+	FirstOnly    bool   `long:"first-only" default:"false" description:"Only use the first address a hostname resolves to."`
+	Parallel     uint   `long:"parallel" short:"j" default:"8" description:"How many servers to run a command on at once."`
+	Timeout      uint   `long:"timeout" short:"t" default:"5" description:"Timeout for connecting and for each response in seconds."`
+	History      string `long:"history" default:"" description:"REPL history file. Defaults to ~/.sourceq_rcon_history."`
+}
+
+var rconOptions RconOptions
+
+const rconPasswordEnv = "SOURCEQ_RCON_PASSWORD"
+
+func rconctx(args []string) {
+	log.SetFlags(0)
+	options := &rconOptions
+
+	password, err := rconPassword(options.PasswordFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addresses := make([]string, 0)
+
+	if options.AddressFile != "" {
+		listed, err := readAddressList(options.AddressFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		addresses = append(addresses, listed...)
+	} else if len(args) > 0 {
+		addresses = append(addresses, args[0])
+		args = args[1:]
+	}
+
+	if len(addresses) == 0 {
+		log.Fatal(
+			"sourceq rcon needs the address of a server.\n" +
+				"e.g. sourceq rcon 10.0.0.5:27015 --password-file pw.txt status\n" +
+				"or, for a list of servers: sourceq rcon --file servers.txt --password-file pw.txt status")
+	}
+
+	resolved := make([]query.ResolvedAddress, 0, len(addresses))
+	for _, addr := range addresses {
+		found, err := query.ResolveServerAddress(addr, options.FirstOnly)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resolved = append(resolved, found...)
+	}
+
+	timeout := time.Duration(options.Timeout) * time.Second
+	command := strings.Join(args, " ")
+
+	if command == "" {
+		if len(resolved) != 1 {
+			log.Fatal("The interactive RCON prompt only works with a single server. Give a command to run.")
+		}
+		rconRepl(resolved[0].Addr, password, timeout, options.History)
+		return
+	}
+
+	results := rconExecAll(resolved, password, command, timeout, options.Parallel)
+	failed := false
+
+	for i, result := range results {
+		if len(results) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("== %s (%s) ==\n", resolved[i].Input, resolved[i].Addr)
+		}
+		if result.err != nil {
+			log.Println("Error:", result.err)
+			failed = true
+			continue
+		}
+		fmt.Print(result.output)
+		if !strings.HasSuffix(result.output, "\n") {
+			fmt.Println()
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+type rconResult struct {
+	output string
+	err    error
+}
+
+// rconExecAll runs command on every server, at most parallel at a time.
+// Results are returned in the order of servers.
+func rconExecAll(servers []query.ResolvedAddress, password, command string, timeout time.Duration, parallel uint) []rconResult {
+	if parallel == 0 {
+		parallel = 1
+	}
+
+	results := make([]rconResult, len(servers))
+	slots := make(chan struct{}, parallel)
+	done := make(DoneChannel)
+
+	for i := range servers {
+		go func(i int) {
+			defer func() { done <- DONE }()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i].output, results[i].err = query.RconExec(servers[i].Addr, password, command, timeout)
+		}(i)
+	}
+
+	for _ = range servers {
+		<-done
+	}
+
+	return results
+}
+
+// rconRepl reads commands from StdIn until EOF or "exit". Besides server
+// commands it understands "history", "!!" and "!N" to rerun earlier lines.
+func rconRepl(addr, password string, timeout time.Duration, historyPath string) {
+	client, err := query.DialRcon(addr, password, timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	if historyPath == "" {
+		historyPath = defaultRconHistoryPath()
+	}
+	history := loadRconHistory(historyPath)
+
+	var historyFile *os.File
+	if historyPath != "" {
+		historyFile, err = os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Println("Not saving history:", err)
+		} else {
+			defer historyFile.Close()
+		}
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	fmt.Printf("Connected to %s. Type \"exit\" to quit.\n", addr)
+
+	for {
+		fmt.Printf("%s> ", addr)
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+
+		line := strings.TrimSpace(in.Text())
+
+		switch {
+		case line == "":
+			continue
+		case line == "exit" || line == "quit":
+			return
+		case line == "history":
+			for i, entry := range history {
+				fmt.Printf("%5d  %s\n", i+1, entry)
+			}
+			continue
+		case strings.HasPrefix(line, "!"):
+			recalled, err := recallRconHistory(history, line)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			line = recalled
+			fmt.Println(line)
+		}
+
+		history = append(history, line)
+		if historyFile != nil {
+			fmt.Fprintln(historyFile, line)
+		}
+
+		output, err := client.Exec(line)
+		fmt.Print(output)
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			fmt.Println()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func recallRconHistory(history []string, line string) (string, error) {
+	if len(history) == 0 {
+		return "", errors.New("History is empty.")
+	}
+	if line == "!!" {
+		return history[len(history)-1], nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(history) {
+		return "", fmt.Errorf("No history entry '%s'.", line[1:])
+	}
+	return history[n-1], nil
+}
+
+func defaultRconHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".sourceq_rcon_history")
+}
+
+func loadRconHistory(path string) []string {
+	history := make([]string, 0)
+	if path == "" {
+		return history
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+	return history
+}
+
+// rconPassword reads the first line of path, or the environment when no
+// file is given. Passwords are never taken on the command line.
+func rconPassword(path string) (string, error) {
+	if path == "" {
+		password := os.Getenv(rconPasswordEnv)
+		if password == "" {
+			return "", errors.New("No RCON password. Use --password-file or set $" + rconPasswordEnv + ".")
+		}
+		return password, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	password := strings.SplitN(string(data), "\n", 2)[0]
+	return strings.TrimRight(password, "\r"), nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScanOptions struct {
+	Ports    string `long:"ports" short:"p" default:"27015-27020" description:"Ports to probe, e.g. 27015-27050,28015"`
+	Rate     uint   `long:"rate" default:"200" description:"Maximum A2S_INFO probes sent per second. Must be at least 1."`
+	Fields   string `long:"fields" default:"ip=21,name" description:"The fields to be included. See sourceq master --list-fields"`
+	Divider  string `long:"divider" default:" ¦ " description:"Characters used to seperate fields."`
+	MaxWidth int    `long:"max-width" default:"0" description:"Cut text rows to this many columns with an ellipsis. 0 fits the terminal; -1 never cuts."`
+	Color    string `long:"color" default:"auto" description:"Colour text output: auto (on a terminal, unless $NO_COLOR is set), always or never. Style it in ~/.sourceq/theme.yaml."`
+	NoHeader bool   `long:"no-header" default:"false" description:"Don't show header w/ column names."`
+	Format   string `long:"format" default:"text" description:"Output format: text or json."`
+	Output   string `long:"output" short:"o" default:"" description:"Also write responding addresses to this file, one per line (see sourceq server --file)."`
+	Timeout  uint   `long:"timeout" short:"T" default:"2" description:"Timeout in seconds to wait for each probe."`
+}
+
+var scanOptions ScanOptions
+
+// Refuse scans that would send more probes than this.
+const maxScanProbes = 1 << 20
+
+func scanctx(targets []string) {
+	log.SetFlags(0)
+	options := &scanOptions
+
+	if len(targets) == 0 {
+		log.Fatal(
+			"sourceq scan needs at least one host or CIDR range.\n" +
+				"e.g. sourceq scan 10.0.0.0/24 --ports 27015-27050")
+	}
+
+	if options.Rate == 0 {
+		log.Fatal("--rate must be at least 1 probe per second.")
+	}
+
+	ports, err := parsePortList(options.Ports)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hosts := make([]net.IP, 0)
+	for _, target := range targets {
+		found, err := expandScanTarget(target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hosts = append(hosts, found...)
+	}
+
+	numProbes := len(hosts) * len(ports)
+	if numProbes > maxScanProbes {
+		log.Fatalf("Refusing to send %d probes (limit %d). Narrow the range or ports.", numProbes, maxScanProbes)
+	}
+
+	fields, err := query.ParseFields(options.Fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	textOptions, err := printerOptions(options.Divider, options.MaxWidth, options.Color)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer, err := query.NewPrinter(options.Format, os.Stdout, textOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var saved *bufio.Writer
+	if options.Output != "" {
+		file, err := os.Create(options.Output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		saved = bufio.NewWriter(file)
+		defer saved.Flush()
+	}
+
+	timeout := time.Duration(options.Timeout) * time.Second
+	rec := make(chan query.Result)
+	printer := make(chan query.Result)
+
+	go probeHosts(rec, hosts, ports, options.Rate, timeout)
+
+	if !options.NoHeader && options.Format == "text" {
+		query.WriteHeader(os.Stdout, fields, textOptions)
+	}
+
+	printed := query.StartPrinter(writer, fields, printer)
+	found := 0
+
+	for i := 0; i < numProbes; i++ {
+		recd := <-rec
+		if recd.Err != nil {
+			continue
+		}
+
+		found++
+		if saved != nil {
+			fmt.Fprintln(saved, recd.Server.Address())
+		}
+		printer <- recd
+	}
+
+	close(printer)
+	<-printed
+	writer.Done()
+
+	log.Println()
+	log.Printf("%d servers answered %d probes.\n", found, numProbes)
+}
+
+// probeHosts sends A2S_INFO to every host:port pair, starting at most rate
+// probes per second; rate must not be 0. Every probe produces exactly one
+// response on send.
+func probeHosts(send chan query.Result, hosts []net.IP, ports []int, rate uint, timeout time.Duration) {
+	interval := time.Second / time.Duration(rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for _, host := range hosts {
+		for _, port := range ports {
+			<-tick.C
+			addr := net.JoinHostPort(host.String(), strconv.Itoa(port))
+			go probeServer(send, addr, timeout)
+		}
+	}
+}
+
+func probeServer(send chan query.Result, addr string, timeout time.Duration) {
+	server := goseq.NewServer()
+	if err := server.SetAddress(addr); err != nil {
+		send <- query.Result{Err: err, Server: server}
+		return
+	}
+
+	sent := time.Now()
+	info, err := query.A2SInfo(context.Background(), addr, timeout)
+	send <- query.Result{Err: err, Server: server, Info: info, Ping: time.Since(sent)}
+}
+
+// parsePortList reads a comma separated list of ports and port ranges.
+func parsePortList(spec string) ([]int, error) {
+	ports := make([]int, 0)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi := part, part
+		if dash := strings.Index(part, "-"); dash >= 0 {
+			lo, hi = part[:dash], part[dash+1:]
+		}
+
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("Bad port '%s'.", lo)
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil {
+			return nil, fmt.Errorf("Bad port '%s'.", hi)
+		}
+		if from < 1 || to > 65535 || from > to {
+			return nil, fmt.Errorf("Bad port range '%s'.", part)
+		}
+
+		for port := from; port <= to; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, errors.New("No ports to scan.")
+	}
+
+	return ports, nil
+}
+
+// expandScanTarget turns a CIDR range, IP or hostname into host IPs. The
+// network and broadcast addresses of IPv4 ranges are skipped.
+func expandScanTarget(target string) ([]net.IP, error) {
+	if !strings.Contains(target, "/") {
+		return query.LookupServerIPs(target)
+	}
+
+	base, network, err := net.ParseCIDR(target)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones > 20 {
+		return nil, fmt.Errorf("Range '%s' is too large to scan.", target)
+	}
+
+	ips := make([]net.IP, 0, 1<<uint(bits-ones))
+	skipEnds := base.To4() != nil && bits-ones >= 2
+
+	for ip := network.IP.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+		ips = append(ips, ip)
+	}
+
+	if skipEnds {
+		ips = ips[1 : len(ips)-1]
+	}
+
+	return ips, nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hfern/goseq"
+	"github.com/hfern/sourceq/query"
+	"golang.org/x/sync/singleflight"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ServeOptions struct {
+	Listen   string `long:"listen" short:"l" default:"127.0.0.1:8080" description:"Address to serve the HTTP API on. Use :8080 to listen on every interface."`
+	MasterIP string `long:"ip" default:"hl2master.steampowered.com:27011" description:"host:port of the Master server to query."`
+	Timeout  uint   `long:"timeout" short:"T" default:"2" description:"Timeout in seconds requests to servers will last."`
+	CacheTTL uint   `long:"cache-ttl" default:"10" description:"Seconds a response is served from cache (0 to disable)."`
+	Parallel uint   `long:"parallel" short:"j" default:"128" description:"Most upstream queries in flight at once, across all requests."`
+}
+
+var serveOptions ServeOptions
+
+// apiQueryTimeout bounds the upstream queries of one response. They don't
+// run under any one client's request, as every client asking for the same
+// key at the time shares them.
+const apiQueryTimeout = time.Minute
+
+type apiServer struct {
+	options *ServeOptions
+	client  *query.Client
+	slots   chan struct{}
+
+	mu    sync.Mutex
+	cache map[string]apiCacheEntry
+
+	// flight makes concurrent misses of the same key share one upstream
+	// query.
+	flight singleflight.Group
+}
+
+type apiCacheEntry struct {
+	expires time.Time
+	status  int
+	body    []byte
+}
+
+// apiError is an error with the HTTP status it should be reported with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func servectx() {
+	log.SetFlags(0)
+	options := &serveOptions
+
+	if options.Parallel == 0 {
+		options.Parallel = 1
+	}
+
+	api := &apiServer{
+		options: options,
+		client:  &query.Client{Timeout: time.Duration(options.Timeout) * time.Second},
+		slots:   make(chan struct{}, options.Parallel),
+		cache:   make(map[string]apiCacheEntry),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master", api.cached(api.handleMaster))
+	mux.HandleFunc("/server/", api.cached(api.handleServer))
+
+	log.Println("Serving on", options.Listen)
+	log.Fatal(http.ListenAndServe(options.Listen, mux))
+}
+
+// cached wraps a handler with the response cache. Responses are keyed by
+// path and the sorted query string, so parameter order doesn't matter.
+func (a *apiServer) cached(handler func(context.Context, *http.Request) (interface{}, *apiError)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeAPIJSON(w, http.StatusMethodNotAllowed, apiErrorBody("Only GET is supported."))
+			return
+		}
+
+		key := r.URL.Path + "?" + r.URL.Query().Encode()
+		ttl := time.Duration(a.options.CacheTTL) * time.Second
+
+		a.mu.Lock()
+		entry, ok := a.cache[key]
+		a.mu.Unlock()
+
+		if ok && time.Now().Before(entry.expires) {
+			w.Header().Set("X-Cache", "HIT")
+			writeAPIBody(w, entry.status, entry.body)
+			return
+		}
+
+		shared, _, _ := a.flight.Do(key, func() (interface{}, error) {
+			entry := apiCacheEntry{expires: time.Now().Add(ttl), status: http.StatusOK}
+
+			ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+			defer cancel()
+			result, apiErr := handler(ctx, r)
+			if apiErr != nil {
+				entry.status = apiErr.status
+				result = apiErrorBody(apiErr.err.Error())
+			}
+
+			var err error
+			entry.body, err = json.Marshal(result)
+			if err != nil {
+				entry.status = http.StatusInternalServerError
+				entry.body, _ = json.Marshal(apiErrorBody(err.Error()))
+			}
+
+			// Only successes are cached; a failed upstream should be retried.
+			if ttl > 0 && entry.status == http.StatusOK {
+				a.mu.Lock()
+				a.expireCache()
+				a.cache[key] = entry
+				a.mu.Unlock()
+			}
+			return entry, nil
+		})
+		entry = shared.(apiCacheEntry)
+
+		w.Header().Set("X-Cache", "MISS")
+		writeAPIBody(w, entry.status, entry.body)
+	}
+}
+
+// expireCache drops stale entries. Callers hold a.mu.
+func (a *apiServer) expireCache() {
+	now := time.Now()
+	for key, entry := range a.cache {
+		if now.After(entry.expires) {
+			delete(a.cache, key)
+		}
+	}
+}
+
+// upstream runs fn while holding one of the upstream query slots.
+func (a *apiServer) upstream(fn func()) {
+	a.slots <- struct{}{}
+	defer func() { <-a.slots }()
+	fn()
+}
+
+// QueryServer queries one server in an upstream slot, so that an address
+// resolving to many servers takes a slot for each.
+func (a *apiServer) QueryServer(ctx context.Context, addr string, what query.What) (attrs query.Attributes, err error) {
+	a.upstream(func() {
+		attrs, err = a.client.QueryServer(ctx, addr, what)
+	})
+	return attrs, err
+}
+
+// handleMaster serves GET /master?region=EU&filter=gamedir:tf&fields=ip,name
+// with the same records sourceq master --json prints.
+func (a *apiServer) handleMaster(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	params := r.URL.Query()
+
+	region := params.Get("region")
+	if region == "" {
+		region = "USW"
+	}
+
+	fieldSpec := params.Get("fields")
+	if fieldSpec == "" {
+		fieldSpec = "ip,name"
+	}
+	fields, err := query.ParseFields(fieldSpec)
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, err}
+	}
+
+	filters, err := parseAPIFilters(params["filter"])
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, err}
+	}
+
+	limit := 0
+	if raw := params.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+			return nil, &apiError{http.StatusBadRequest, fmt.Errorf("Bad limit '%s'.", raw)}
+		}
+	}
+
+	var servers []goseq.Server
+	a.upstream(func() {
+		servers, err = masterListWithoutBlacklist(ctx, a.client, query.MasterOptions{
+			Region:  region,
+			Master:  a.options.MasterIP,
+			Start:   params.Get("start"),
+			Filters: filters,
+		})
+	})
+	if err != nil {
+		return nil, &apiError{http.StatusBadGateway, err}
+	}
+
+	rec := make(chan query.Result)
+	for _, server := range servers {
+		go func(server goseq.Server) {
+			var sv query.Result
+			a.upstream(func() {
+				sv = a.client.QueryInfo(ctx, server)
+			})
+			rec <- sv
+		}(server)
+	}
+
+	records := make([]map[string]Any, 0, len(servers))
+	for range servers {
+		sv := <-rec
+		if sv.Err != nil || (limit > 0 && len(records) >= limit) {
+			continue
+		}
+		records = append(records, query.Record(sv, fields))
+	}
+
+	return records, nil
+}
+
+// handleServer serves GET /server/{addr}?players=1&rules=1 with the same
+// shape as sourceq server --json. Info is always included; players and
+// rules are opt-in.
+func (a *apiServer) handleServer(ctx context.Context, r *http.Request) (interface{}, *apiError) {
+	addr, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/server/"))
+	if err != nil || addr == "" {
+		return nil, &apiError{http.StatusBadRequest, errors.New("Expected /server/{address}.")}
+	}
+
+	params := r.URL.Query()
+	options := &ServerQueryOptions{
+		NoPlayers: !apiFlag(params.Get("players")),
+		NoRules:   !apiFlag(params.Get("rules")),
+	}
+
+	servers, err := queryServers(ctx, a, false, []string{addr}, apiFlag(params.Get("first")), options.what())
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, err}
+	}
+
+	return jsonFormatServers(options, servers), nil
+}
+
+// parseAPIFilters reads repeated filter=name:value parameters.
+func parseAPIFilters(raw []string) (map[string]string, error) {
+	filters := make(map[string]string, len(raw))
+	for _, filter := range raw {
+		parts := strings.SplitN(filter, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Bad filter '%s', expected name:value.", filter)
+		}
+		filters[parts[0]] = parts[1]
+	}
+	return filters, nil
+}
+
+func apiFlag(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+func apiErrorBody(message string) interface{} {
+	return struct{ Error string }{Error: message}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	body, _ := json.Marshal(value)
+	writeAPIBody(w, status, body)
+}
+
+func writeAPIBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -1,187 +1,268 @@
 package main
 
 import (
-	"github.com/hfern/goseq"
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"io"
 	"log"
+	"os"
+	"strings"
 	"time"
 )
 
 type ServerQueryOptions struct {
-	NoPlayers    bool `long:"no-players" short:"P" default:"false" description:"Don't list players."`
-	NoInfo       bool `long:"no-info" short:"I" default:"false" description:"Don't list general info."`
-	NoRules      bool `long:"no-rules" short:"R" default:"false" description:"Don't list server rules."`
-	Serial       bool `long:"serial" short:"s" default:"false" description:"Force serial querying of server attributes."`
-	Json         bool `long:"json" default:"false" description:"Output as JSON to StdOut"`
-	Timeout      uint `long:"timeout" short:"t" default:"2" description:"Timeout for attribute queries in seconds."`
-	OnlyKeywords bool `long:"only-keywords" short:"K" default:"false" description:"Only list the keywords of the servers one per line."`
+	NoPlayers        bool   `long:"no-players" short:"P" default:"false" description:"Don't list players."`
+	NoInfo           bool   `long:"no-info" short:"I" default:"false" description:"Don't list general info."`
+	NoRules          bool   `long:"no-rules" short:"R" default:"false" description:"Don't list server rules."`
+	Serial           bool   `long:"serial" short:"s" default:"false" description:"Force serial querying of server attributes."`
+	Json             bool   `long:"json" default:"false" description:"Output as JSON to StdOut"`
+	Timeout          uint   `long:"timeout" short:"t" default:"2" description:"Timeout for attribute queries in seconds."`
+	OnlyKeywords     bool   `long:"only-keywords" short:"K" default:"false" description:"Only list the keywords of the servers one per line."`
+	FirstOnly        bool   `long:"first-only" default:"false" description:"Only query the first address a hostname resolves to."`
+	AddressFile      string `long:"file" short:"F" default:"" description:"Also read server addresses from a file, one per line ('-' for StdIn)."`
+	Rcon             bool   `long:"rcon" default:"false" description:"Add ping, loss, SteamID and address to players from RCON status. Password from $SOURCEQ_RCON_PASSWORD."`
+	RconPasswordFile string `long:"rcon-password-file" default:"" description:"File holding the RCON password. Implies --rcon."`
+	CacheTTL         uint   `long:"cache-ttl" default:"0" description:"Reuse info, players and rules cached on disk within this many seconds (0 disables the cache)."`
+	NoCache          bool   `long:"no-cache" default:"false" description:"Query the servers even if a cached result is fresh."`
+	Color            string `long:"color" default:"auto" description:"Colour text output: auto (on a terminal, unless $NO_COLOR is set), always or never. Style it in ~/.sourceq/theme.yaml."`
+	Template         string `long:"template" default:"" description:"Print each server with a Go text/template; .Players and .Rules can be ranged over. See the README."`
+	Schema           bool   `long:"schema" default:"false" description:"Print the JSON Schema of --json output and exit."`
+	Format           string `long:"format" default:"" description:"Output format: text, json, markdown or html (a page with sortable tables)."`
+
+	rconPassword string
+	theme        query.Theme
 }
 
 type DoneChannel chan int
 
 const DONE int = 0
 
-type MaybePlayers struct {
-	Error   error
-	Players []goseq.Player
-}
-
-type MaybeInfo struct {
-	Error error
-	Info  goseq.ServerInfo
-}
-
-type MaybeRules struct {
-	Error error
-	Rules goseq.RuleMap
-}
-
-type ServerQueryableAttributes struct {
-	Address string
-	Players MaybePlayers
-	Info    MaybeInfo
-	Rules   MaybeRules
-}
-
-type ServerAttrPair struct {
-	Server goseq.Server
-	Attrs  ServerQueryableAttributes
-}
-
-type doIf struct {
-	cond bool
-	call func(DoneChannel)
-}
-
 var serverSingleOptions ServerQueryOptions
 
 func serverctx(serverAddresses []string) {
 	options := &serverSingleOptions
 
+	if options.Schema {
+		fmt.Print(serverSchema)
+		return
+	}
+
 	if !assertLogicalServerFlags(options) {
 		return
 	}
 
+	if options.Rcon || options.RconPasswordFile != "" {
+		password, err := rconPassword(options.RconPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.rconPassword = password
+	}
+
+	cache, err := openResponseCache(options.CacheTTL, options.NoCache)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if options.theme, err = outputTheme(options.Color); err != nil {
+		log.Fatal(err)
+	}
+
+	if options.AddressFile != "" {
+		listed, err := readAddressList(options.AddressFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serverAddresses = append(serverAddresses, listed...)
+	}
+
 	if len(serverAddresses) == 0 {
 		log.Fatal(
 			"The first argument to sourceq server must be the address of the server. \n" +
 				"e.g. sourceq server google.com\n" +
 				"or sourceq server google.com:8080\n" +
 				"or sourceq server 192.168.1.1:6060\n" +
+				"or sourceq server [2001:db8::1]:27015\n" +
 				"or, for multiple servers: \n\tsourceq server google.com:80 example.org 123.156.178")
 		return
 	}
 
-	timeout := time.Duration(options.Timeout) * time.Second
-	done := make(DoneChannel)
+	client := &query.Client{
+		Timeout:      time.Duration(options.Timeout) * time.Second,
+		Cache:        cache,
+		RconPassword: options.rconPassword,
+		Serial:       options.Serial,
+	}
 
-	servers := make([]ServerAttrPair, len(serverAddresses))
+	servers, err := queryServers(context.Background(), client, options.Serial, serverAddresses, options.FirstOnly, options.what())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	for i, serverAddr := range serverAddresses {
-		servers[i].Attrs.Address = serverAddr
-		server := goseq.NewServer()
-		err := server.SetAddress(serverAddr)
+	if options.Template != "" {
+		viewServerTemplate(options, servers)
+	} else if options.Json || options.Format == "json" {
+		viewServerJSON(options, servers)
+	} else if options.Format == "markdown" || options.Format == "html" {
+		viewServerReport(options, servers)
+	} else {
+		viewServerText(options, servers)
+	}
+}
+
+// serverQuerier queries one server; a *query.Client does.
+type serverQuerier interface {
+	QueryServer(ctx context.Context, addr string, what query.What) (query.Attributes, error)
+}
+
+// queryServers resolves each address into one or more servers and queries
+// all of them, one at a time if serial, keeping the order the addresses
+// were given in.
+func queryServers(ctx context.Context, client serverQuerier, serial bool, addresses []string, firstOnly bool, what query.What) ([]query.Attributes, error) {
+	resolved, err := resolveServers(addresses, firstOnly)
+	if err != nil {
+		return nil, err
+	}
+	return queryResolved(ctx, client, serial, resolved, what), nil
+}
+
+// resolveServers resolves each address into the servers it stands for.
+func resolveServers(addresses []string, firstOnly bool) ([]query.ResolvedAddress, error) {
+	resolved := make([]query.ResolvedAddress, 0, len(addresses))
+
+	for _, addr := range addresses {
+		found, err := query.ResolveServerAddress(addr, firstOnly)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		servers[i].Server = server
+		resolved = append(resolved, found...)
 	}
 
-	for i, _ := range servers {
-		server := &servers[i]
-		go queryServer(options, &server.Server, &server.Attrs, timeout, done)
-		if options.Serial {
+	return resolved, nil
+}
+
+// queryResolved queries servers resolveServers found, in their order.
+func queryResolved(ctx context.Context, client serverQuerier, serial bool, resolved []query.ResolvedAddress, what query.What) []query.Attributes {
+	servers := make([]query.Attributes, len(resolved))
+	done := make(DoneChannel)
+
+	for i, addr := range resolved {
+		go func(i int, addr query.ResolvedAddress) {
+			defer func() { done <- DONE }()
+			// Addresses are already resolved, so this can't fail.
+			servers[i], _ = client.QueryServer(ctx, addr.Addr, what)
+			servers[i].Address = addr.Input
+		}(i, addr)
+		if serial {
 			<-done
 		}
 	}
 
-	if !options.Serial {
-		for _ = range servers {
+	if !serial {
+		for range resolved {
 			<-done
 		}
 	}
 
-	if options.Json {
-		viewServerJSON(options, servers)
-	} else {
-		viewServerText(options, servers)
-	}
+	return servers
 }
 
-func assertLogicalServerFlags(options *ServerQueryOptions) bool {
-	if options.OnlyKeywords {
-		if options.Json {
-			log.Fatal("--only-keywords cannot be used with --json")
-			return false
-		}
-		options.NoRules = true
-		options.NoPlayers = true
-		options.NoInfo = false
+// what is the set of attributes the options ask for.
+func (options *ServerQueryOptions) what() query.What {
+	var what query.What
+	if !options.NoInfo {
+		what |= query.Info
 	}
-	return true
+	if !options.NoPlayers {
+		what |= query.Players
+	}
+	if !options.NoRules {
+		what |= query.Rules
+	}
+	return what
 }
 
-func queryServer(
-	options *ServerQueryOptions,
-	server *goseq.Server,
-	attrs *ServerQueryableAttributes,
-	timeout time.Duration,
-	serverIsDone DoneChannel) {
+// viewServerTemplate renders --template once per server.
+func viewServerTemplate(options *ServerQueryOptions, servers []query.Attributes) {
+	tmpl, err := query.ParseTemplate(options.Template)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	defer func() { serverIsDone <- DONE }()
+	writer := query.NewTemplatePrinter(os.Stdout, tmpl)
+	results := make(chan query.Result)
+	printed := query.StartPrinter(writer, nil, results)
 
-	done := make(DoneChannel)
+	for _, server := range servers {
+		results <- server.Result()
+	}
+	close(results)
 
-	callbacks := []doIf{
-		{
-			cond: !options.NoInfo,
-			call: func(donner DoneChannel) {
-				getServerInfo(server, &attrs.Info, timeout, donner)
-			},
-		},
-		{
-			cond: !options.NoRules,
-			call: func(donner DoneChannel) {
-				getServerRules(server, &attrs.Rules, timeout, donner)
-			},
-		},
-		{
-			cond: !options.NoPlayers,
-			call: func(donner DoneChannel) {
-				getServerPlayers(server, &attrs.Players, timeout, donner)
-			},
-		},
-	}
-
-	for _, cb := range callbacks {
-		if cb.cond {
-			go cb.call(done)
-			if options.Serial {
-				<-done
-			}
-		}
+	<-printed
+	writer.Done()
+
+	if err := writer.Err(); err != nil {
+		log.Fatal(err)
 	}
+}
+
+// readAddressList reads one server address per line, skipping blank lines
+// and # comments. A path of "-" reads StdIn.
+func readAddressList(path string) ([]string, error) {
+	var in io.Reader = os.Stdin
 
-	if !options.Serial {
-		for _, cb := range callbacks {
-			if cb.cond {
-				<-done
-			}
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
 		}
+		defer file.Close()
+		in = file
 	}
 
-}
+	addresses := make([]string, 0)
+	scanner := bufio.NewScanner(in)
 
-func getServerInfo(server *goseq.Server, info *MaybeInfo, timeout time.Duration, donner DoneChannel) {
-	defer func() { donner <- DONE }()
-	info.Info, info.Error = (*server).Info(timeout)
-}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addresses = append(addresses, line)
+	}
 
-func getServerRules(server *goseq.Server, rules *MaybeRules, timeout time.Duration, donner DoneChannel) {
-	defer func() { donner <- DONE }()
-	rules.Rules, rules.Error = (*server).Rules(timeout)
+	return addresses, scanner.Err()
 }
 
-func getServerPlayers(server *goseq.Server, plys *MaybePlayers, timeout time.Duration, donner DoneChannel) {
-	defer func() { donner <- DONE }()
-	plys.Players, plys.Error = (*server).Players(timeout)
+func assertLogicalServerFlags(options *ServerQueryOptions) bool {
+	if options.OnlyKeywords {
+		if options.Json {
+			log.Fatal("--only-keywords cannot be used with --json")
+			return false
+		}
+		options.NoRules = true
+		options.NoPlayers = true
+		options.NoInfo = false
+	}
+	if options.Template != "" && (options.Json || options.OnlyKeywords) {
+		log.Fatal("--template cannot be used with --json or --only-keywords")
+		return false
+	}
+	switch options.Format {
+	case "", "text", "json", "markdown", "html":
+	default:
+		log.Fatalf("Unknown output format '%s'.", options.Format)
+		return false
+	}
+	if options.Format != "" && (options.Json || options.OnlyKeywords || options.Template != "") {
+		log.Fatal("--format cannot be used with --json, --only-keywords or --template")
+		return false
+	}
+	if options.NoPlayers && (options.Rcon || options.RconPasswordFile != "") {
+		log.Fatal("--rcon only adds to the player list and cannot be used with --no-players")
+		return false
+	}
+	return true
 }
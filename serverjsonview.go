@@ -1,23 +1,119 @@
 package main
 
 import (
+	_ "embed"
 	"encoding/json"
 	"fmt"
+	"github.com/hfern/sourceq/query"
+	"strconv"
+	"time"
 )
 
-type jsonResponseWrapper struct {
-	Servers []interface{}
+// serverSchemaVersion is bumped whenever a key of sourceq server --json is
+// renamed, retyped or removed. Adding keys doesn't change it.
+const serverSchemaVersion = 1
+
+// serverSchema is the JSON Schema of sourceq server --json, printed by
+// --schema.
+//
+//go:embed schema/server.schema.json
+var serverSchema string
+
+// serversJSON is the document sourceq server --json prints.
+type serversJSON struct {
+	SchemaVersion int          `json:"schema_version"`
+	Servers       []serverJSON `json:"servers"`
 }
 
-func viewServerJSON(options *ServerQueryOptions, servers []ServerAttrPair) {
-	formattedServers := make([]interface{}, len(servers))
-	for i, server := range servers {
-		formattedServers[i] = jsonFormatServer(server, options)
-	}
+// serverJSON is one queried server. Sections left out with --no-info,
+// --no-players or --no-rules are omitted.
+type serverJSON struct {
+	Address  string       `json:"address"`
+	Resolved string       `json:"resolved"`
+	Engine   string       `json:"engine"`
+	Info     *infoJSON    `json:"info,omitempty"`
+	Players  *playersJSON `json:"players,omitempty"`
+	Rules    *rulesJSON   `json:"rules,omitempty"`
+}
+
+// errorJSON is how every failure is reported.
+type errorJSON struct {
+	Message string `json:"message"`
+}
+
+// sectionJSON is common to info, players and rules: the error if the query
+// failed, and the age in seconds of a cached answer.
+type sectionJSON struct {
+	Error    *errorJSON `json:"error,omitempty"`
+	CacheAge *float64   `json:"cache_age,omitempty"`
+}
 
-	wrapper := jsonResponseWrapper{Servers: formattedServers}
+// infoJSON is the A2S_INFO reply; its fields are only set without an
+// error.
+type infoJSON struct {
+	sectionJSON
+	*serverInfoJSON
+}
 
-	encoded, err := json.Marshal(wrapper)
+type serverInfoJSON struct {
+	Name          string      `json:"name"`
+	Map           string      `json:"map"`
+	Folder        string      `json:"folder"`
+	Game          string      `json:"game"`
+	AppID         int         `json:"app_id"`
+	Players       int         `json:"players"`
+	MaxPlayers    int         `json:"max_players"`
+	Bots          int         `json:"bots"`
+	ServerType    string      `json:"server_type"`
+	Environment   string      `json:"environment"`
+	Password      bool        `json:"password"`
+	VAC           bool        `json:"vac"`
+	Version       string      `json:"version"`
+	Port          int         `json:"port"`
+	SteamID       string      `json:"steam_id"`
+	GameID        string      `json:"game_id"`
+	Keywords      string      `json:"keywords"`
+	SpectatorPort int         `json:"spectator_port"`
+	SpectatorName string      `json:"spectator_name"`
+	TheShip       theShipJSON `json:"the_ship"`
+}
+
+type theShipJSON struct {
+	Mode      int `json:"mode"`
+	Witnesses int `json:"witnesses"`
+	Duration  int `json:"duration"`
+}
+
+type playersJSON struct {
+	sectionJSON
+	RconError *errorJSON   `json:"rcon_error,omitempty"`
+	Players   []playerJSON `json:"players"`
+}
+
+type playerJSON struct {
+	Index    int     `json:"index"`
+	Name     string  `json:"name"`
+	Score    int     `json:"score"`
+	Duration float64 `json:"duration"`
+	*rconPlayerJSON
+}
+
+// rconPlayerJSON is what --rcon adds to a player found in RCON status.
+type rconPlayerJSON struct {
+	UserID  int    `json:"user_id"`
+	Ping    int    `json:"ping"`
+	Loss    int    `json:"loss"`
+	SteamID string `json:"steam_id"`
+	Address string `json:"address"`
+}
+
+type rulesJSON struct {
+	sectionJSON
+	Rules map[string]string `json:"rules"`
+}
+
+func viewServerJSON(options *ServerQueryOptions, servers []query.Attributes) {
+	encoded, err := json.Marshal(jsonFormatServers(options, servers))
 	if err != nil {
 		panic(err)
 	}
@@ -25,85 +121,160 @@ func viewServerJSON(options *ServerQueryOptions, servers []ServerAttrPair) {
 	fmt.Print(string(encoded))
 }
 
-func jsonFormatServer(server ServerAttrPair, opts *ServerQueryOptions) interface{} {
-	return map[string]interface{}{
-		"Address": server.Attrs.Address,
-		"Players": jsonFormatPlayers(server.Attrs.Players, opts),
-		"Info":    jsonFormatInfo(server.Attrs.Info, opts),
-		"Rules":   jsonFormatRules(server.Attrs.Rules, opts),
+func jsonFormatServers(options *ServerQueryOptions, servers []query.Attributes) serversJSON {
+	formattedServers := make([]serverJSON, len(servers))
+	for i, server := range servers {
+		formattedServers[i] = jsonFormatServer(server, options)
 	}
+	return serversJSON{SchemaVersion: serverSchemaVersion, Servers: formattedServers}
 }
 
-func jsonFormatRules(rules MaybeRules, opts *ServerQueryOptions) interface{} {
-	if opts.NoRules {
-		return nil
+func jsonFormatServer(server query.Attributes, opts *ServerQueryOptions) serverJSON {
+	return serverJSON{
+		Address:  server.Address,
+		Resolved: server.Resolved,
+		Engine:   server.Engine,
+		Players:  jsonFormatPlayers(server.Players, opts),
+		Info:     jsonFormatInfo(server.Info, opts),
+		Rules:    jsonFormatRules(server.Rules, opts),
 	}
+}
 
-	ret := struct {
-		Error interface{}
-		Rules interface{}
-	}{}
+func jsonSection(err error, age time.Duration) sectionJSON {
+	section := sectionJSON{Error: jsonError(err)}
+	if age > 0 {
+		seconds := query.AgeSeconds(age)
+		section.CacheAge = &seconds
+	}
+	return section
+}
 
-	if rules.Error != nil {
-		ret.Error = rules.Error.Error()
-		ret.Rules = nil
-		return ret
+func jsonError(err error) *errorJSON {
+	if err == nil {
+		return nil
 	}
+	return &errorJSON{Message: err.Error()}
+}
 
-	ret.Rules = make(map[string]interface{})
+func jsonFormatRules(rules query.MaybeRules, opts *ServerQueryOptions) *rulesJSON {
+	if opts.NoRules {
+		return nil
+	}
+
+	ret := &rulesJSON{
+		sectionJSON: jsonSection(rules.Error, rules.Age),
+		Rules:       make(map[string]string, len(rules.Rules)),
+	}
+	if rules.Error == nil {
+		for name, value := range rules.Rules {
+			ret.Rules[name] = value
+		}
+	}
 
 	return ret
 }
 
-func jsonFormatInfo(info MaybeInfo, opts *ServerQueryOptions) interface{} {
+func jsonFormatInfo(info query.MaybeInfo, opts *ServerQueryOptions) *infoJSON {
 	if opts.NoInfo {
 		return nil
 	}
-	ret := struct {
-		Error interface{}
-		Info  interface{}
-	}{
-		Error: nil,
-		Info:  nil,
+
+	ret := &infoJSON{sectionJSON: jsonSection(info.Error, info.Age)}
+	if info.Error != nil {
+		return ret
 	}
 
-	if info.Error == nil {
-		ret.Info = info.Info
-	} else {
-		ret.Error = info.Error.Error()
+	i := info.Info
+	ret.serverInfoJSON = &serverInfoJSON{
+		Name:          i.GetName(),
+		Map:           i.GetMap(),
+		Folder:        i.GetFolder(),
+		Game:          i.GetGame(),
+		AppID:         int(i.GetID()),
+		Players:       int(i.GetPlayers()),
+		MaxPlayers:    int(i.GetMaxPlayers()),
+		Bots:          int(i.GetBots()),
+		ServerType:    serverTypeName(byte(i.GetServertype())),
+		Environment:   environmentName(byte(i.GetEnvironment())),
+		Password:      i.GetVisibility() == 1,
+		VAC:           i.GetVAC() == 1,
+		Version:       i.GetVersion(),
+		Port:          int(i.GetPort()),
+		SteamID:       strconv.FormatInt(int64(i.GetSteamID()), 10),
+		GameID:        strconv.FormatInt(int64(i.GetGameID()), 10),
+		Keywords:      i.GetKeywords(),
+		SpectatorPort: int(i.GetSpectatorPort()),
+		SpectatorName: i.GetSpectatorName(),
+		TheShip: theShipJSON{
+			Mode:      int(i.GetMode()),
+			Witnesses: int(i.GetWitnesses()),
+			Duration:  int(i.GetDuration()),
+		},
 	}
 
 	return ret
 }
 
-func jsonFormatPlayers(mbplys MaybePlayers, opts *ServerQueryOptions) interface{} {
-	players := mbplys.Players
-	if opts.NoPlayers {
-		return nil
+// serverTypeName names the A2S_INFO server type code.
+func serverTypeName(code byte) string {
+	switch code {
+	case 'd', 'D':
+		return "dedicated"
+	case 'l', 'L':
+		return "listen"
+	case 'p', 'P':
+		return "proxy"
 	}
-	fmtPlayers := make([]map[string]interface{}, len(players))
+	return "unknown"
+}
 
-	for i, player := range players {
-		ply := make(map[string]interface{})
-		ply["Index"] = player.Index()
-		ply["Name"] = player.Name()
-		ply["Duration"] = player.Duration()
-		ply["Score"] = player.Score()
-		fmtPlayers[i] = ply
+// environmentName names the A2S_INFO environment code.
+func environmentName(code byte) string {
+	switch code {
+	case 'l', 'L':
+		return "linux"
+	case 'w', 'W':
+		return "windows"
+	case 'm', 'o':
+		return "mac"
 	}
+	return "unknown"
+}
 
-	type ReturnStruct struct {
-		Error   interface{}
-		Players interface{}
+func jsonFormatPlayers(mbplys query.MaybePlayers, opts *ServerQueryOptions) *playersJSON {
+	if opts.NoPlayers {
+		return nil
 	}
 
-	ret := ReturnStruct{
-		Error:   nil,
-		Players: fmtPlayers,
+	ret := &playersJSON{
+		sectionJSON: jsonSection(mbplys.Error, mbplys.Age),
+		RconError:   jsonError(mbplys.RconError),
+		Players:     make([]playerJSON, 0, len(mbplys.Players)),
 	}
-
 	if mbplys.Error != nil {
-		ret.Error = mbplys.Error.Error()
+		return ret
+	}
+
+	for i, player := range mbplys.Players {
+		ply := playerJSON{
+			Index:    player.Index(),
+			Name:     player.Name(),
+			Score:    player.Score(),
+			Duration: player.Duration().Seconds(),
+		}
+
+		if mbplys.Details != nil && mbplys.Details[i] != nil {
+			detail := mbplys.Details[i]
+			ply.rconPlayerJSON = &rconPlayerJSON{
+				UserID:  detail.UserID,
+				Ping:    detail.Ping,
+				Loss:    detail.Loss,
+				SteamID: detail.SteamID,
+				Address: detail.Address,
+			}
+		}
+
+		ret.Players = append(ret.Players, ply)
 	}
 
 	return ret
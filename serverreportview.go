@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportInfoFields are the info fields a server report lists, by their
+// registry headers.
+const reportInfoFields = "name,map,game,folder,players,maxplayers,bots,humans,servertype,environment,password,vac,version,keywords,port,steamid,gameid"
+
+// serverReport writes the sections of a server report in markdown or HTML.
+type serverReport struct {
+	out  io.Writer
+	html bool
+}
+
+func viewServerReport(options *ServerQueryOptions, servers []query.Attributes) {
+	report := serverReport{out: os.Stdout, html: options.Format == "html"}
+
+	if report.html {
+		query.WriteHTMLStart(report.out, "Servers")
+	}
+	for _, server := range servers {
+		report.server(server, options)
+	}
+	if report.html {
+		query.WriteHTMLEnd(report.out)
+	}
+}
+
+func (r serverReport) server(server query.Attributes, options *ServerQueryOptions) {
+	title := server.Address
+	if server.Resolved != server.Address {
+		title += " (" + server.Resolved + ")"
+	}
+	r.heading(2, title)
+
+	if !options.NoInfo {
+		r.heading(3, "Info")
+		if server.Info.Error != nil {
+			r.error("Error fetching server info: " + server.Info.Error.Error())
+		} else {
+			r.info(server)
+		}
+	}
+
+	if !options.NoPlayers {
+		r.heading(3, "Players")
+		if server.Players.Error != nil {
+			r.error("Error fetching player list: " + server.Players.Error.Error())
+		} else {
+			if server.Players.RconError != nil {
+				r.error("Error fetching RCON status: " + server.Players.RconError.Error())
+			}
+			r.players(server.Players)
+		}
+	}
+
+	if !options.NoRules {
+		r.heading(3, "Rules")
+		if server.Rules.Error != nil {
+			r.error("Error fetching server rules: " + server.Rules.Error.Error())
+		} else {
+			r.rules(server.Rules)
+		}
+	}
+}
+
+func (r serverReport) info(server query.Attributes) {
+	sv := server.Result()
+	fields, _ := query.ParseFields(reportInfoFields)
+
+	rows := [][]string{{"Engine", server.Engine}}
+	for _, field := range fields {
+		text := query.FieldText(field.Name, query.FieldValue(sv, field.Name))
+		rows = append(rows, []string{query.FieldTitle(field.Name), query.CleanText(text)})
+	}
+
+	r.table([]string{"Field", "Value"}, rows, nil, []query.Alignment{query.AlignLeft, query.AlignLeft})
+}
+
+func (r serverReport) players(players query.MaybePlayers) {
+	enriched := players.Details != nil
+
+	header := []string{"#", "Name", "Id", "Score", "Time"}
+	aligns := []query.Alignment{query.AlignRight, query.AlignLeft, query.AlignRight, query.AlignRight, query.AlignLeft}
+	if enriched {
+		header = append(header, "Ping", "Loss", "SteamID", "Address")
+		aligns = append(aligns, query.AlignRight, query.AlignRight, query.AlignLeft, query.AlignLeft)
+	}
+
+	// The HTML table sorts Time by seconds, as 1h2m0s sorts before 5m0s
+	// by its text.
+	rows := make([][]string, 0, len(players.Players))
+	sortKeys := make([][]string, 0, len(players.Players))
+	for i, player := range players.Players {
+		played := player.Duration().Truncate(time.Second)
+		row := []string{
+			strconv.Itoa(i + 1),
+			query.CleanText(player.Name()),
+			strconv.Itoa(player.Index()),
+			strconv.Itoa(player.Score()),
+			played.String(),
+		}
+		sortKey := make([]string, len(header))
+		sortKey[4] = strconv.Itoa(int(played / time.Second))
+		sortKeys = append(sortKeys, sortKey)
+
+		if enriched {
+			if detail := players.Details[i]; detail != nil {
+				row = append(row, strconv.Itoa(detail.Ping), strconv.Itoa(detail.Loss), detail.SteamID, detail.Address)
+			} else {
+				row = append(row, "", "", "", "")
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	r.table(header, rows, sortKeys, aligns)
+}
+
+func (r serverReport) rules(rules query.MaybeRules) {
+	names := make([]string, 0, len(rules.Rules))
+	for name := range rules.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([][]string, len(names))
+	for i, name := range names {
+		rows[i] = []string{query.CleanText(name), query.CleanText(fmt.Sprint(rules.Rules[name]))}
+	}
+
+	r.table([]string{"Rule", "Value"}, rows, nil, []query.Alignment{query.AlignLeft, query.AlignLeft})
+}
+
+func (r serverReport) heading(level int, text string) {
+	if r.html {
+		fmt.Fprintf(r.out, "<h%d>%s</h%d>\n", level, html.EscapeString(text), level)
+		return
+	}
+	fmt.Fprintf(r.out, "%s %s\n\n", strings.Repeat("#", level), query.MarkdownText(text))
+}
+
+func (r serverReport) error(text string) {
+	text = query.CleanText(text)
+	if r.html {
+		fmt.Fprintf(r.out, "<p class=\"error\">%s</p>\n", html.EscapeString(text))
+		return
+	}
+	fmt.Fprintf(r.out, "*%s*\n\n", query.MarkdownText(text))
+}
+
+// table writes rows; sortKeys only matter to HTML, see query.WriteHTMLTable.
+func (r serverReport) table(header []string, rows [][]string, sortKeys [][]string, aligns []query.Alignment) {
+	if r.html {
+		query.WriteHTMLTable(r.out, header, rows, sortKeys, aligns)
+		return
+	}
+	query.WriteMarkdownTable(r.out, header, rows, aligns)
+	fmt.Fprintln(r.out)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/hfern/sourceq/query"
 	"log"
 	"sort"
 	"strconv"
@@ -24,30 +25,42 @@ var defaultIdent Ident = Ident{
 	promptActive: false,
 }
 
-func viewServerText(options *ServerQueryOptions, servers []ServerAttrPair) {
+func viewServerText(options *ServerQueryOptions, servers []query.Attributes) {
 	for _, server := range servers {
 		textFormatServer(server, defaultIdent, options)
 	}
 }
 
-func textFormatServer(server ServerAttrPair, ident Ident, options *ServerQueryOptions) {
+func textFormatServer(server query.Attributes, ident Ident, options *ServerQueryOptions) {
 
 	if options.OnlyKeywords {
-		listKeywords(server.Attrs.Info)
+		listKeywords(server.Info)
 		return
 	}
 
-	ident.Println("Server: ", server.Attrs.Address)
+	addrStyle := options.theme[query.RoleReachable]
+	if !server.Answered(options.what()) {
+		addrStyle = options.theme[query.RoleUnreachable]
+	}
+
+	ident.Println("Server: ", addrStyle.Wrap(server.Address))
+	if server.Resolved != server.Address {
+		ident.Println("Resolved: ", server.Resolved)
+	}
 	ident.level++
 
-	textFormatServerInfo(server.Attrs.Info, ident, options)
-	textFormatPlayers(server.Attrs.Players, ident, options)
+	if !options.NoInfo {
+		ident.Println("Engine: ", server.Engine)
+	}
+
+	textFormatServerInfo(server.Info, ident, options)
+	textFormatPlayers(server.Players, ident, options)
 
 	ident.level--
 	ident.Println("")
 }
 
-func listKeywords(info MaybeInfo) {
+func listKeywords(info query.MaybeInfo) {
 	if info.Error != nil {
 		log.Println("Error fetching AS_INFO keywords: ", info.Error.Error())
 	}
@@ -58,7 +71,7 @@ func listKeywords(info MaybeInfo) {
 	}
 }
 
-func textFormatPlayers(players MaybePlayers, ident Ident, options *ServerQueryOptions) {
+func textFormatPlayers(players query.MaybePlayers, ident Ident, options *ServerQueryOptions) {
 	if options.NoPlayers {
 		return
 	}
@@ -67,85 +80,81 @@ func textFormatPlayers(players MaybePlayers, ident Ident, options *ServerQueryOp
 	ident.level++
 
 	if players.Error != nil {
-		ident.Println("Error fetching player list: ", players.Error.Error())
+		ident.Println(options.theme[query.RoleError].Wrap("Error fetching player list: " + players.Error.Error()))
 		return
 	}
 
-	type PlayerRow struct {
-		RowID    string
-		Name     string
-		Index    string
-		Score    string
-		Duration string
+	if players.RconError != nil {
+		ident.Println(options.theme[query.RoleError].Wrap("Error fetching RCON status: " + players.RconError.Error()))
 	}
 
-	plrRows := make([]PlayerRow, 0, len(players.Players)+1)
-	plrRows = append(plrRows, PlayerRow{
-		RowID:    "  ",
-		Name:     "Name",
-		Index:    "Id",
-		Score:    "Scr",
-		Duration: "Time",
-	})
+	enriched := players.Details != nil
+
+	header := []string{"  ", "Name", "Id", "Scr", "Time"}
+	alignRight := []bool{true, false, false, true, false}
+
+	if enriched {
+		header = append(header, "Ping", "Loss", "SteamID", "Address")
+		alignRight = append(alignRight, true, true, false, false)
+	}
+
+	plrRows := make([][]string, 0, len(players.Players)+1)
+	plrRows = append(plrRows, header)
 
 	for i, player := range players.Players {
-		col := PlayerRow{
-			RowID: strconv.Itoa(i + 1),
-			Name:  player.Name(),
-			Index: strconv.Itoa(player.Index()),
-			Score: strconv.Itoa(player.Score()),
+		row := []string{
+			strconv.Itoa(i + 1),
+			query.CleanText(player.Name()),
+			strconv.Itoa(player.Index()),
+			strconv.Itoa(player.Score()),
 			// round to 1s
-			Duration: (player.Duration() - (player.Duration() % time.Second)).String(),
+			(player.Duration() - (player.Duration() % time.Second)).String(),
 		}
-		plrRows = append(plrRows, col)
-	}
 
-	largest := func(things []PlayerRow, stringer func(PlayerRow) string) int {
-		max := 0
-		for _, thing := range things {
-			sz := len(stringer(thing))
-			if sz > max {
-				max = sz
+		if enriched {
+			if detail := players.Details[i]; detail != nil {
+				row = append(row,
+					strconv.Itoa(detail.Ping),
+					strconv.Itoa(detail.Loss),
+					detail.SteamID,
+					detail.Address,
+				)
+			} else {
+				row = append(row, "", "", "", "")
 			}
 		}
-		return max
+
+		plrRows = append(plrRows, row)
 	}
 
-	maxColumnSizes := struct {
-		RowID    int
-		Name     int
-		Index    int
-		Score    int
-		Duration int
-	}{
-		RowID:    largest(plrRows, func(r PlayerRow) string { return r.RowID }),
-		Name:     largest(plrRows, func(r PlayerRow) string { return r.Name }),
-		Index:    largest(plrRows, func(r PlayerRow) string { return r.Index }),
-		Score:    largest(plrRows, func(r PlayerRow) string { return r.Score }),
-		Duration: largest(plrRows, func(r PlayerRow) string { return r.Duration }),
+	maxColumnSizes := make([]int, len(header))
+	for _, row := range plrRows {
+		for j, cell := range row {
+			if width := query.DisplayWidth(cell); width > maxColumnSizes[j] {
+				maxColumnSizes[j] = width
+			}
+		}
 	}
 
 	for i, row := range plrRows {
-		ident.Printf(
-			" %v | %v | %v | %v | %v \n",
-			paddedR(row.RowID, maxColumnSizes.RowID),
-			padded(row.Name, maxColumnSizes.Name),
-			padded(row.Index, maxColumnSizes.Index),
-			paddedR(row.Score, maxColumnSizes.Score),
-			padded(row.Duration, maxColumnSizes.Duration),
-		)
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			if alignRight[j] {
+				cells[j] = paddedR(cell, maxColumnSizes[j])
+			} else {
+				cells[j] = padded(cell, maxColumnSizes[j])
+			}
+			if i == 0 {
+				cells[j] = options.theme[query.RoleHeader].Wrap(cells[j])
+			}
+		}
+
+		ident.Printf(" %s \n", strings.Join(cells, " | "))
 
 		if i == 0 {
-			lengths := []int{
-				maxColumnSizes.RowID,
-				maxColumnSizes.Name,
-				maxColumnSizes.Index,
-				maxColumnSizes.Score,
-				maxColumnSizes.Duration,
-			}
 			divider := ""
 
-			for j, length := range lengths {
+			for j, length := range maxColumnSizes {
 				if j != 0 {
 					divider = divider + "+"
 				}
@@ -158,7 +167,7 @@ func textFormatPlayers(players MaybePlayers, ident Ident, options *ServerQueryOp
 	ident.Println("")
 }
 
-func textFormatServerInfo(info MaybeInfo, ident Ident, options *ServerQueryOptions) {
+func textFormatServerInfo(info query.MaybeInfo, ident Ident, options *ServerQueryOptions) {
 	if options.NoInfo {
 		return
 	}
@@ -167,7 +176,7 @@ func textFormatServerInfo(info MaybeInfo, ident Ident, options *ServerQueryOptio
 	ident.level++
 
 	if info.Error != nil {
-		ident.Println("Error fetching server info: ", info.Error.Error())
+		ident.Println(options.theme[query.RoleError].Wrap("Error fetching server info: " + info.Error.Error()))
 		return
 	}
 
@@ -213,8 +222,17 @@ func textFormatServerInfo(info MaybeInfo, ident Ident, options *ServerQueryOptio
 		if _, ok := filters[key]; ok {
 			val = filters[key](val)
 		}
+		if text, ok := val.(string); ok {
+			val = query.CleanText(text)
+		}
+		switch {
+		case key == "Visibility" && val == 1.0:
+			val = options.theme[query.RolePassword].Wrap(fmt.Sprint(val))
+		case key == "VAC" && val == 0.0:
+			val = options.theme[query.RoleNoVAC].Wrap(fmt.Sprint(val))
+		}
 
-		ident.Printf("%s:%s %v\n", key, pad(maxKeySize-len(key)), val)
+		ident.Printf("%s:%s %v\n", options.theme[query.RoleLabel].Wrap(key), pad(maxKeySize-len(key)), val)
 	}
 
 	ident.promptActive = false
@@ -248,13 +266,16 @@ func getKeys(amap map[string]interface{}) []string {
 }
 
 func pad(n int) string {
+	if n <= 0 {
+		return ""
+	}
 	return strings.Repeat(" ", n)
 }
 
 func padded(text string, padLength int) string {
-	return text + pad(padLength-len(text))
+	return query.PadText(text, padLength, query.AlignLeft)
 }
 
 func paddedR(text string, padLength int) string {
-	return pad(padLength-len(text)) + text
+	return query.PadText(text, padLength, query.AlignRight)
 }
@@ -0,0 +1,1080 @@
+// The sourceq gRPC service, served by sourceq grpc --listen. Regenerate
+// the Go code after changing this file with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	    --go-grpc_out=. --go-grpc_opt=paths=source_relative sourceqpb/sourceq.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: sourceqpb/sourceq.proto
+
+package sourceqpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// MasterRequest mirrors the options of sourceq master that make sense
+// remotely. The rest are left out on purpose: the timeout is the call's
+// deadline, the cache and RCON stay with the server's own settings, and
+// where, sort and fields are for the client to apply to what it receives.
+type MasterRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Region code, e.g. "EU". Defaults to "USW".
+	Region string `protobuf:"bytes,1,opt,name=region,proto3" json:"region,omitempty"`
+	// host:port of the master server. Defaults to the server's --ip.
+	Master string `protobuf:"bytes,2,opt,name=master,proto3" json:"master,omitempty"`
+	// Address to continue the listing after.
+	Start string `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	// Master server filters by name, e.g. {"gamedir": "tf"}.
+	Filters map[string]string `protobuf:"bytes,4,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Most successful results sent; 0 for all.
+	Limit uint32 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Also send servers that didn't answer, with error set.
+	IncludeUnreachable bool `protobuf:"varint,6,opt,name=include_unreachable,json=includeUnreachable,proto3" json:"include_unreachable,omitempty"`
+	// Don't drop servers matched by the server's blacklist.
+	NoBlacklist   bool `protobuf:"varint,7,opt,name=no_blacklist,json=noBlacklist,proto3" json:"no_blacklist,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MasterRequest) Reset() {
+	*x = MasterRequest{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MasterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MasterRequest) ProtoMessage() {}
+
+func (x *MasterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MasterRequest.ProtoReflect.Descriptor instead.
+func (*MasterRequest) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MasterRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *MasterRequest) GetMaster() string {
+	if x != nil {
+		return x.Master
+	}
+	return ""
+}
+
+func (x *MasterRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *MasterRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *MasterRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *MasterRequest) GetIncludeUnreachable() bool {
+	if x != nil {
+		return x.IncludeUnreachable
+	}
+	return false
+}
+
+func (x *MasterRequest) GetNoBlacklist() bool {
+	if x != nil {
+		return x.NoBlacklist
+	}
+	return false
+}
+
+// ServerResult is one server from a master listing.
+type ServerResult struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Address string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// Set when the server didn't answer; info is then empty.
+	Error *Error      `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Info  *ServerInfo `protobuf:"bytes,3,opt,name=info,proto3" json:"info,omitempty"`
+	// Round trip of the A2S_INFO query.
+	PingMs uint32 `protobuf:"varint,4,opt,name=ping_ms,json=pingMs,proto3" json:"ping_ms,omitempty"`
+	// Age of a cached answer in seconds; 0 when fresh.
+	CacheAge      float64 `protobuf:"fixed64,5,opt,name=cache_age,json=cacheAge,proto3" json:"cache_age,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerResult) Reset() {
+	*x = ServerResult{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerResult) ProtoMessage() {}
+
+func (x *ServerResult) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerResult.ProtoReflect.Descriptor instead.
+func (*ServerResult) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ServerResult) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ServerResult) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *ServerResult) GetInfo() *ServerInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *ServerResult) GetPingMs() uint32 {
+	if x != nil {
+		return x.PingMs
+	}
+	return 0
+}
+
+func (x *ServerResult) GetCacheAge() float64 {
+	if x != nil {
+		return x.CacheAge
+	}
+	return 0
+}
+
+// ServerRequest mirrors the options of sourceq server, less those left out
+// of MasterRequest for the same reasons.
+type ServerRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Addresses as sourceq server takes them: IPs, hostnames or SRV names,
+	// with optional ports. At most 32, resolving to at most 32 servers.
+	Addresses []string `protobuf:"bytes,1,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	NoInfo    bool     `protobuf:"varint,2,opt,name=no_info,json=noInfo,proto3" json:"no_info,omitempty"`
+	NoPlayers bool     `protobuf:"varint,3,opt,name=no_players,json=noPlayers,proto3" json:"no_players,omitempty"`
+	NoRules   bool     `protobuf:"varint,4,opt,name=no_rules,json=noRules,proto3" json:"no_rules,omitempty"`
+	// Only query the first address a hostname resolves to.
+	FirstOnly     bool `protobuf:"varint,5,opt,name=first_only,json=firstOnly,proto3" json:"first_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerRequest) Reset() {
+	*x = ServerRequest{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerRequest) ProtoMessage() {}
+
+func (x *ServerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerRequest.ProtoReflect.Descriptor instead.
+func (*ServerRequest) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ServerRequest) GetAddresses() []string {
+	if x != nil {
+		return x.Addresses
+	}
+	return nil
+}
+
+func (x *ServerRequest) GetNoInfo() bool {
+	if x != nil {
+		return x.NoInfo
+	}
+	return false
+}
+
+func (x *ServerRequest) GetNoPlayers() bool {
+	if x != nil {
+		return x.NoPlayers
+	}
+	return false
+}
+
+func (x *ServerRequest) GetNoRules() bool {
+	if x != nil {
+		return x.NoRules
+	}
+	return false
+}
+
+func (x *ServerRequest) GetFirstOnly() bool {
+	if x != nil {
+		return x.FirstOnly
+	}
+	return false
+}
+
+// ServerDetails holds every server a ServerRequest resolved to, in the
+// order the addresses were given.
+type ServerDetails struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Servers       []*Server              `protobuf:"bytes,1,rep,name=servers,proto3" json:"servers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerDetails) Reset() {
+	*x = ServerDetails{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerDetails) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerDetails) ProtoMessage() {}
+
+func (x *ServerDetails) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerDetails.ProtoReflect.Descriptor instead.
+func (*ServerDetails) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ServerDetails) GetServers() []*Server {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+// Server is one queried server. Sections a ServerRequest left out are
+// unset.
+type Server struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The address as given.
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// The ip:port queried.
+	Resolved string `protobuf:"bytes,2,opt,name=resolved,proto3" json:"resolved,omitempty"`
+	// "Source" or "GoldSource".
+	Engine        string          `protobuf:"bytes,3,opt,name=engine,proto3" json:"engine,omitempty"`
+	Info          *InfoSection    `protobuf:"bytes,4,opt,name=info,proto3" json:"info,omitempty"`
+	Players       *PlayersSection `protobuf:"bytes,5,opt,name=players,proto3" json:"players,omitempty"`
+	Rules         *RulesSection   `protobuf:"bytes,6,opt,name=rules,proto3" json:"rules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Server) Reset() {
+	*x = Server{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Server) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Server) ProtoMessage() {}
+
+func (x *Server) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Server.ProtoReflect.Descriptor instead.
+func (*Server) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Server) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Server) GetResolved() string {
+	if x != nil {
+		return x.Resolved
+	}
+	return ""
+}
+
+func (x *Server) GetEngine() string {
+	if x != nil {
+		return x.Engine
+	}
+	return ""
+}
+
+func (x *Server) GetInfo() *InfoSection {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *Server) GetPlayers() *PlayersSection {
+	if x != nil {
+		return x.Players
+	}
+	return nil
+}
+
+func (x *Server) GetRules() *RulesSection {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type InfoSection struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Error    *Error                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	CacheAge float64                `protobuf:"fixed64,2,opt,name=cache_age,json=cacheAge,proto3" json:"cache_age,omitempty"`
+	// Unset when error is.
+	Info          *ServerInfo `protobuf:"bytes,3,opt,name=info,proto3" json:"info,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InfoSection) Reset() {
+	*x = InfoSection{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InfoSection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InfoSection) ProtoMessage() {}
+
+func (x *InfoSection) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InfoSection.ProtoReflect.Descriptor instead.
+func (*InfoSection) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InfoSection) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *InfoSection) GetCacheAge() float64 {
+	if x != nil {
+		return x.CacheAge
+	}
+	return 0
+}
+
+func (x *InfoSection) GetInfo() *ServerInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+// ServerInfo is an A2S_INFO reply.
+type ServerInfo struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Name       string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Map        string                 `protobuf:"bytes,2,opt,name=map,proto3" json:"map,omitempty"`
+	Folder     string                 `protobuf:"bytes,3,opt,name=folder,proto3" json:"folder,omitempty"`
+	Game       string                 `protobuf:"bytes,4,opt,name=game,proto3" json:"game,omitempty"`
+	AppId      int32                  `protobuf:"varint,5,opt,name=app_id,json=appId,proto3" json:"app_id,omitempty"`
+	Players    int32                  `protobuf:"varint,6,opt,name=players,proto3" json:"players,omitempty"`
+	MaxPlayers int32                  `protobuf:"varint,7,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
+	Bots       int32                  `protobuf:"varint,8,opt,name=bots,proto3" json:"bots,omitempty"`
+	// "dedicated", "listen", "proxy" or "unknown".
+	ServerType string `protobuf:"bytes,9,opt,name=server_type,json=serverType,proto3" json:"server_type,omitempty"`
+	// "linux", "windows", "mac" or "unknown".
+	Environment   string `protobuf:"bytes,10,opt,name=environment,proto3" json:"environment,omitempty"`
+	Password      bool   `protobuf:"varint,11,opt,name=password,proto3" json:"password,omitempty"`
+	Vac           bool   `protobuf:"varint,12,opt,name=vac,proto3" json:"vac,omitempty"`
+	Version       string `protobuf:"bytes,13,opt,name=version,proto3" json:"version,omitempty"`
+	Port          int32  `protobuf:"varint,14,opt,name=port,proto3" json:"port,omitempty"`
+	SteamId       uint64 `protobuf:"varint,15,opt,name=steam_id,json=steamId,proto3" json:"steam_id,omitempty"`
+	GameId        uint64 `protobuf:"varint,16,opt,name=game_id,json=gameId,proto3" json:"game_id,omitempty"`
+	Keywords      string `protobuf:"bytes,17,opt,name=keywords,proto3" json:"keywords,omitempty"`
+	SpectatorPort int32  `protobuf:"varint,18,opt,name=spectator_port,json=spectatorPort,proto3" json:"spectator_port,omitempty"`
+	SpectatorName string `protobuf:"bytes,19,opt,name=spectator_name,json=spectatorName,proto3" json:"spectator_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerInfo) Reset() {
+	*x = ServerInfo{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerInfo) ProtoMessage() {}
+
+func (x *ServerInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerInfo.ProtoReflect.Descriptor instead.
+func (*ServerInfo) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ServerInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetMap() string {
+	if x != nil {
+		return x.Map
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetGame() string {
+	if x != nil {
+		return x.Game
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetAppId() int32 {
+	if x != nil {
+		return x.AppId
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetPlayers() int32 {
+	if x != nil {
+		return x.Players
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetMaxPlayers() int32 {
+	if x != nil {
+		return x.MaxPlayers
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetBots() int32 {
+	if x != nil {
+		return x.Bots
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetServerType() string {
+	if x != nil {
+		return x.ServerType
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetEnvironment() string {
+	if x != nil {
+		return x.Environment
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetPassword() bool {
+	if x != nil {
+		return x.Password
+	}
+	return false
+}
+
+func (x *ServerInfo) GetVac() bool {
+	if x != nil {
+		return x.Vac
+	}
+	return false
+}
+
+func (x *ServerInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetSteamId() uint64 {
+	if x != nil {
+		return x.SteamId
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetGameId() uint64 {
+	if x != nil {
+		return x.GameId
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetKeywords() string {
+	if x != nil {
+		return x.Keywords
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetSpectatorPort() int32 {
+	if x != nil {
+		return x.SpectatorPort
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetSpectatorName() string {
+	if x != nil {
+		return x.SpectatorName
+	}
+	return ""
+}
+
+type PlayersSection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         *Error                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	CacheAge      float64                `protobuf:"fixed64,2,opt,name=cache_age,json=cacheAge,proto3" json:"cache_age,omitempty"`
+	Players       []*Player              `protobuf:"bytes,3,rep,name=players,proto3" json:"players,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayersSection) Reset() {
+	*x = PlayersSection{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayersSection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayersSection) ProtoMessage() {}
+
+func (x *PlayersSection) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayersSection.ProtoReflect.Descriptor instead.
+func (*PlayersSection) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PlayersSection) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *PlayersSection) GetCacheAge() float64 {
+	if x != nil {
+		return x.CacheAge
+	}
+	return 0
+}
+
+func (x *PlayersSection) GetPlayers() []*Player {
+	if x != nil {
+		return x.Players
+	}
+	return nil
+}
+
+type Player struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Index int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Score int32                  `protobuf:"varint,3,opt,name=score,proto3" json:"score,omitempty"`
+	// Seconds connected.
+	Duration      float64 `protobuf:"fixed64,4,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Player) Reset() {
+	*x = Player{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Player) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Player) ProtoMessage() {}
+
+func (x *Player) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Player.ProtoReflect.Descriptor instead.
+func (*Player) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Player) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Player) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Player) GetScore() int32 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Player) GetDuration() float64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+type RulesSection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         *Error                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	CacheAge      float64                `protobuf:"fixed64,2,opt,name=cache_age,json=cacheAge,proto3" json:"cache_age,omitempty"`
+	Rules         map[string]string      `protobuf:"bytes,3,rep,name=rules,proto3" json:"rules,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RulesSection) Reset() {
+	*x = RulesSection{}
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RulesSection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RulesSection) ProtoMessage() {}
+
+func (x *RulesSection) ProtoReflect() protoreflect.Message {
+	mi := &file_sourceqpb_sourceq_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RulesSection.ProtoReflect.Descriptor instead.
+func (*RulesSection) Descriptor() ([]byte, []int) {
+	return file_sourceqpb_sourceq_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *RulesSection) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *RulesSection) GetCacheAge() float64 {
+	if x != nil {
+		return x.CacheAge
+	}
+	return 0
+}
+
+func (x *RulesSection) GetRules() map[string]string {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+var File_sourceqpb_sourceq_proto protoreflect.FileDescriptor
+
+const file_sourceqpb_sourceq_proto_rawDesc = "" +
+	"\n" +
+	"\x17sourceqpb/sourceq.proto\x12\n" +
+	"sourceq.v1\"\xbd\x02\n" +
+	"\rMasterRequest\x12\x16\n" +
+	"\x06region\x18\x01 \x01(\tR\x06region\x12\x16\n" +
+	"\x06master\x18\x02 \x01(\tR\x06master\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\tR\x05start\x12@\n" +
+	"\afilters\x18\x04 \x03(\v2&.sourceq.v1.MasterRequest.FiltersEntryR\afilters\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\rR\x05limit\x12/\n" +
+	"\x13include_unreachable\x18\x06 \x01(\bR\x12includeUnreachable\x12!\n" +
+	"\fno_blacklist\x18\a \x01(\bR\vnoBlacklist\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb3\x01\n" +
+	"\fServerResult\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12'\n" +
+	"\x05error\x18\x02 \x01(\v2\x11.sourceq.v1.ErrorR\x05error\x12*\n" +
+	"\x04info\x18\x03 \x01(\v2\x16.sourceq.v1.ServerInfoR\x04info\x12\x17\n" +
+	"\aping_ms\x18\x04 \x01(\rR\x06pingMs\x12\x1b\n" +
+	"\tcache_age\x18\x05 \x01(\x01R\bcacheAge\"\x9f\x01\n" +
+	"\rServerRequest\x12\x1c\n" +
+	"\taddresses\x18\x01 \x03(\tR\taddresses\x12\x17\n" +
+	"\ano_info\x18\x02 \x01(\bR\x06noInfo\x12\x1d\n" +
+	"\n" +
+	"no_players\x18\x03 \x01(\bR\tnoPlayers\x12\x19\n" +
+	"\bno_rules\x18\x04 \x01(\bR\anoRules\x12\x1d\n" +
+	"\n" +
+	"first_only\x18\x05 \x01(\bR\tfirstOnly\"=\n" +
+	"\rServerDetails\x12,\n" +
+	"\aservers\x18\x01 \x03(\v2\x12.sourceq.v1.ServerR\aservers\"\xe9\x01\n" +
+	"\x06Server\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x1a\n" +
+	"\bresolved\x18\x02 \x01(\tR\bresolved\x12\x16\n" +
+	"\x06engine\x18\x03 \x01(\tR\x06engine\x12+\n" +
+	"\x04info\x18\x04 \x01(\v2\x17.sourceq.v1.InfoSectionR\x04info\x124\n" +
+	"\aplayers\x18\x05 \x01(\v2\x1a.sourceq.v1.PlayersSectionR\aplayers\x12.\n" +
+	"\x05rules\x18\x06 \x01(\v2\x18.sourceq.v1.RulesSectionR\x05rules\"!\n" +
+	"\x05Error\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\"\x7f\n" +
+	"\vInfoSection\x12'\n" +
+	"\x05error\x18\x01 \x01(\v2\x11.sourceq.v1.ErrorR\x05error\x12\x1b\n" +
+	"\tcache_age\x18\x02 \x01(\x01R\bcacheAge\x12*\n" +
+	"\x04info\x18\x03 \x01(\v2\x16.sourceq.v1.ServerInfoR\x04info\"\x81\x04\n" +
+	"\n" +
+	"ServerInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03map\x18\x02 \x01(\tR\x03map\x12\x16\n" +
+	"\x06folder\x18\x03 \x01(\tR\x06folder\x12\x12\n" +
+	"\x04game\x18\x04 \x01(\tR\x04game\x12\x15\n" +
+	"\x06app_id\x18\x05 \x01(\x05R\x05appId\x12\x18\n" +
+	"\aplayers\x18\x06 \x01(\x05R\aplayers\x12\x1f\n" +
+	"\vmax_players\x18\a \x01(\x05R\n" +
+	"maxPlayers\x12\x12\n" +
+	"\x04bots\x18\b \x01(\x05R\x04bots\x12\x1f\n" +
+	"\vserver_type\x18\t \x01(\tR\n" +
+	"serverType\x12 \n" +
+	"\venvironment\x18\n" +
+	" \x01(\tR\venvironment\x12\x1a\n" +
+	"\bpassword\x18\v \x01(\bR\bpassword\x12\x10\n" +
+	"\x03vac\x18\f \x01(\bR\x03vac\x12\x18\n" +
+	"\aversion\x18\r \x01(\tR\aversion\x12\x12\n" +
+	"\x04port\x18\x0e \x01(\x05R\x04port\x12\x19\n" +
+	"\bsteam_id\x18\x0f \x01(\x04R\asteamId\x12\x17\n" +
+	"\agame_id\x18\x10 \x01(\x04R\x06gameId\x12\x1a\n" +
+	"\bkeywords\x18\x11 \x01(\tR\bkeywords\x12%\n" +
+	"\x0espectator_port\x18\x12 \x01(\x05R\rspectatorPort\x12%\n" +
+	"\x0espectator_name\x18\x13 \x01(\tR\rspectatorName\"\x84\x01\n" +
+	"\x0ePlayersSection\x12'\n" +
+	"\x05error\x18\x01 \x01(\v2\x11.sourceq.v1.ErrorR\x05error\x12\x1b\n" +
+	"\tcache_age\x18\x02 \x01(\x01R\bcacheAge\x12,\n" +
+	"\aplayers\x18\x03 \x03(\v2\x12.sourceq.v1.PlayerR\aplayers\"d\n" +
+	"\x06Player\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05score\x18\x03 \x01(\x05R\x05score\x12\x1a\n" +
+	"\bduration\x18\x04 \x01(\x01R\bduration\"\xc9\x01\n" +
+	"\fRulesSection\x12'\n" +
+	"\x05error\x18\x01 \x01(\v2\x11.sourceq.v1.ErrorR\x05error\x12\x1b\n" +
+	"\tcache_age\x18\x02 \x01(\x01R\bcacheAge\x129\n" +
+	"\x05rules\x18\x03 \x03(\v2#.sourceq.v1.RulesSection.RulesEntryR\x05rules\x1a8\n" +
+	"\n" +
+	"RulesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\x96\x01\n" +
+	"\vSourceQuery\x12D\n" +
+	"\vListServers\x12\x19.sourceq.v1.MasterRequest\x1a\x18.sourceq.v1.ServerResult0\x01\x12A\n" +
+	"\tGetServer\x12\x19.sourceq.v1.ServerRequest\x1a\x19.sourceq.v1.ServerDetailsB$Z\"github.com/hfern/sourceq/sourceqpbb\x06proto3"
+
+var (
+	file_sourceqpb_sourceq_proto_rawDescOnce sync.Once
+	file_sourceqpb_sourceq_proto_rawDescData []byte
+)
+
+func file_sourceqpb_sourceq_proto_rawDescGZIP() []byte {
+	file_sourceqpb_sourceq_proto_rawDescOnce.Do(func() {
+		file_sourceqpb_sourceq_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sourceqpb_sourceq_proto_rawDesc), len(file_sourceqpb_sourceq_proto_rawDesc)))
+	})
+	return file_sourceqpb_sourceq_proto_rawDescData
+}
+
+var file_sourceqpb_sourceq_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_sourceqpb_sourceq_proto_goTypes = []any{
+	(*MasterRequest)(nil),  // 0: sourceq.v1.MasterRequest
+	(*ServerResult)(nil),   // 1: sourceq.v1.ServerResult
+	(*ServerRequest)(nil),  // 2: sourceq.v1.ServerRequest
+	(*ServerDetails)(nil),  // 3: sourceq.v1.ServerDetails
+	(*Server)(nil),         // 4: sourceq.v1.Server
+	(*Error)(nil),          // 5: sourceq.v1.Error
+	(*InfoSection)(nil),    // 6: sourceq.v1.InfoSection
+	(*ServerInfo)(nil),     // 7: sourceq.v1.ServerInfo
+	(*PlayersSection)(nil), // 8: sourceq.v1.PlayersSection
+	(*Player)(nil),         // 9: sourceq.v1.Player
+	(*RulesSection)(nil),   // 10: sourceq.v1.RulesSection
+	nil,                    // 11: sourceq.v1.MasterRequest.FiltersEntry
+	nil,                    // 12: sourceq.v1.RulesSection.RulesEntry
+}
+var file_sourceqpb_sourceq_proto_depIdxs = []int32{
+	11, // 0: sourceq.v1.MasterRequest.filters:type_name -> sourceq.v1.MasterRequest.FiltersEntry
+	5,  // 1: sourceq.v1.ServerResult.error:type_name -> sourceq.v1.Error
+	7,  // 2: sourceq.v1.ServerResult.info:type_name -> sourceq.v1.ServerInfo
+	4,  // 3: sourceq.v1.ServerDetails.servers:type_name -> sourceq.v1.Server
+	6,  // 4: sourceq.v1.Server.info:type_name -> sourceq.v1.InfoSection
+	8,  // 5: sourceq.v1.Server.players:type_name -> sourceq.v1.PlayersSection
+	10, // 6: sourceq.v1.Server.rules:type_name -> sourceq.v1.RulesSection
+	5,  // 7: sourceq.v1.InfoSection.error:type_name -> sourceq.v1.Error
+	7,  // 8: sourceq.v1.InfoSection.info:type_name -> sourceq.v1.ServerInfo
+	5,  // 9: sourceq.v1.PlayersSection.error:type_name -> sourceq.v1.Error
+	9,  // 10: sourceq.v1.PlayersSection.players:type_name -> sourceq.v1.Player
+	5,  // 11: sourceq.v1.RulesSection.error:type_name -> sourceq.v1.Error
+	12, // 12: sourceq.v1.RulesSection.rules:type_name -> sourceq.v1.RulesSection.RulesEntry
+	0,  // 13: sourceq.v1.SourceQuery.ListServers:input_type -> sourceq.v1.MasterRequest
+	2,  // 14: sourceq.v1.SourceQuery.GetServer:input_type -> sourceq.v1.ServerRequest
+	1,  // 15: sourceq.v1.SourceQuery.ListServers:output_type -> sourceq.v1.ServerResult
+	3,  // 16: sourceq.v1.SourceQuery.GetServer:output_type -> sourceq.v1.ServerDetails
+	15, // [15:17] is the sub-list for method output_type
+	13, // [13:15] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_sourceqpb_sourceq_proto_init() }
+func file_sourceqpb_sourceq_proto_init() {
+	if File_sourceqpb_sourceq_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sourceqpb_sourceq_proto_rawDesc), len(file_sourceqpb_sourceq_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sourceqpb_sourceq_proto_goTypes,
+		DependencyIndexes: file_sourceqpb_sourceq_proto_depIdxs,
+		MessageInfos:      file_sourceqpb_sourceq_proto_msgTypes,
+	}.Build()
+	File_sourceqpb_sourceq_proto = out.File
+	file_sourceqpb_sourceq_proto_goTypes = nil
+	file_sourceqpb_sourceq_proto_depIdxs = nil
+}
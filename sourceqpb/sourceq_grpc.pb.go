@@ -0,0 +1,181 @@
+// The sourceq gRPC service, served by sourceq grpc --listen. Regenerate
+// the Go code after changing this file with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	    --go-grpc_out=. --go-grpc_opt=paths=source_relative sourceqpb/sourceq.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: sourceqpb/sourceq.proto
+
+package sourceqpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SourceQuery_ListServers_FullMethodName = "/sourceq.v1.SourceQuery/ListServers"
+	SourceQuery_GetServer_FullMethodName   = "/sourceq.v1.SourceQuery/GetServer"
+)
+
+// SourceQueryClient is the client API for SourceQuery service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SourceQuery queries master servers and game servers on behalf of its
+// clients.
+type SourceQueryClient interface {
+	// ListServers lists the servers a master server knows about and streams
+	// the A2S_INFO result of each as it arrives.
+	ListServers(ctx context.Context, in *MasterRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServerResult], error)
+	// GetServer queries game servers for their info, players and rules.
+	GetServer(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (*ServerDetails, error)
+}
+
+type sourceQueryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSourceQueryClient(cc grpc.ClientConnInterface) SourceQueryClient {
+	return &sourceQueryClient{cc}
+}
+
+func (c *sourceQueryClient) ListServers(ctx context.Context, in *MasterRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServerResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SourceQuery_ServiceDesc.Streams[0], SourceQuery_ListServers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MasterRequest, ServerResult]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SourceQuery_ListServersClient = grpc.ServerStreamingClient[ServerResult]
+
+func (c *sourceQueryClient) GetServer(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (*ServerDetails, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServerDetails)
+	err := c.cc.Invoke(ctx, SourceQuery_GetServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SourceQueryServer is the server API for SourceQuery service.
+// All implementations must embed UnimplementedSourceQueryServer
+// for forward compatibility.
+//
+// SourceQuery queries master servers and game servers on behalf of its
+// clients.
+type SourceQueryServer interface {
+	// ListServers lists the servers a master server knows about and streams
+	// the A2S_INFO result of each as it arrives.
+	ListServers(*MasterRequest, grpc.ServerStreamingServer[ServerResult]) error
+	// GetServer queries game servers for their info, players and rules.
+	GetServer(context.Context, *ServerRequest) (*ServerDetails, error)
+	mustEmbedUnimplementedSourceQueryServer()
+}
+
+// UnimplementedSourceQueryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSourceQueryServer struct{}
+
+func (UnimplementedSourceQueryServer) ListServers(*MasterRequest, grpc.ServerStreamingServer[ServerResult]) error {
+	return status.Errorf(codes.Unimplemented, "method ListServers not implemented")
+}
+func (UnimplementedSourceQueryServer) GetServer(context.Context, *ServerRequest) (*ServerDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServer not implemented")
+}
+func (UnimplementedSourceQueryServer) mustEmbedUnimplementedSourceQueryServer() {}
+func (UnimplementedSourceQueryServer) testEmbeddedByValue()                     {}
+
+// UnsafeSourceQueryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SourceQueryServer will
+// result in compilation errors.
+type UnsafeSourceQueryServer interface {
+	mustEmbedUnimplementedSourceQueryServer()
+}
+
+func RegisterSourceQueryServer(s grpc.ServiceRegistrar, srv SourceQueryServer) {
+	// If the following call pancis, it indicates UnimplementedSourceQueryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SourceQuery_ServiceDesc, srv)
+}
+
+func _SourceQuery_ListServers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MasterRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SourceQueryServer).ListServers(m, &grpc.GenericServerStream[MasterRequest, ServerResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SourceQuery_ListServersServer = grpc.ServerStreamingServer[ServerResult]
+
+func _SourceQuery_GetServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceQueryServer).GetServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SourceQuery_GetServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceQueryServer).GetServer(ctx, req.(*ServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SourceQuery_ServiceDesc is the grpc.ServiceDesc for SourceQuery service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SourceQuery_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sourceq.v1.SourceQuery",
+	HandlerType: (*SourceQueryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetServer",
+			Handler:    _SourceQuery_GetServer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListServers",
+			Handler:       _SourceQuery_ListServers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sourceqpb/sourceq.proto",
+}
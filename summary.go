@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hfern/sourceq/query"
+	"sort"
+	"strings"
+)
+
+// ServerSummary aggregates a master query into totals and distributions.
+type ServerSummary struct {
+	Servers       int
+	Players       int
+	Bots          int
+	Humans        int
+	Slots         int
+	ByMap         map[string]int
+	ByGame        map[string]int
+	ByEnvironment map[string]int
+	ByVAC         map[string]int
+	ByVersion     map[string]int
+	FillRate      []FillBucket
+}
+
+type FillBucket struct {
+	Label   string
+	Servers int
+}
+
+// Bucket upper bounds in percent; a server lands in the first bucket whose
+// bound it does not exceed.
+var fillBucketBounds = []struct {
+	label string
+	upTo  int
+}{
+	{"empty", 0},
+	{"1-24%", 24},
+	{"25-49%", 49},
+	{"50-74%", 74},
+	{"75-99%", 99},
+	{"full", 100},
+}
+
+// Servers reporting no maxplayers have no fill rate; they're counted in a
+// bucket of their own after the others.
+const fillUnknownLabel = "unknown"
+
+func newServerSummary() *ServerSummary {
+	summary := &ServerSummary{
+		ByMap:         make(map[string]int),
+		ByGame:        make(map[string]int),
+		ByEnvironment: make(map[string]int),
+		ByVAC:         make(map[string]int),
+		ByVersion:     make(map[string]int),
+		FillRate:      make([]FillBucket, len(fillBucketBounds)+1),
+	}
+	for i, bucket := range fillBucketBounds {
+		summary.FillRate[i].Label = bucket.label
+	}
+	summary.FillRate[len(fillBucketBounds)].Label = fillUnknownLabel
+	return summary
+}
+
+func (s *ServerSummary) Add(sv query.Result) {
+	if sv.Err != nil {
+		return
+	}
+
+	info := sv.Info
+	players := query.ToInt(info.GetPlayers())
+	bots := query.ToInt(info.GetBots())
+	max := query.ToInt(info.GetMaxPlayers())
+
+	s.Servers++
+	s.Players += players
+	s.Bots += bots
+	s.Humans += players - bots
+	s.Slots += max
+
+	s.ByMap[info.GetMap()]++
+	s.ByGame[info.GetGame()]++
+	s.ByEnvironment[query.FieldText("environment", info.GetEnvironment())]++
+	s.ByVersion[info.GetVersion()]++
+
+	if query.ToInt(info.GetVAC()) == 1 {
+		s.ByVAC["secured"]++
+	} else {
+		s.ByVAC["insecure"]++
+	}
+
+	if max <= 0 {
+		s.FillRate[len(fillBucketBounds)].Servers++
+		return
+	}
+
+	fill := players * 100 / max
+	for i, bucket := range fillBucketBounds {
+		if fill <= bucket.upTo || i == len(fillBucketBounds)-1 {
+			s.FillRate[i].Servers++
+			break
+		}
+	}
+}
+
+// summaryWriter is a Printer that prints only the aggregate of the rows.
+type summaryWriter struct {
+	in      <-chan query.Result
+	json    bool
+	top     int
+	summary *ServerSummary
+}
+
+func (w *summaryWriter) Init(fields []query.FieldSpec, in <-chan query.Result) {
+	w.in = in
+	w.summary = newServerSummary()
+}
+
+func (w *summaryWriter) Run() {
+	for sv := range w.in {
+		w.summary.Add(sv)
+	}
+}
+
+func (w *summaryWriter) Done() {
+	if w.json {
+		text, err := json.Marshal(w.summary)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(string(text))
+		return
+	}
+
+	s := w.summary
+	ident := defaultIdent
+
+	ident.Println("Summary:")
+	ident.level++
+	ident.Printf("Servers: %d\n", s.Servers)
+	ident.Printf("Players: %d (%d humans, %d bots)\n", s.Players, s.Humans, s.Bots)
+	ident.Printf("Slots:   %d\n", s.Slots)
+	ident.Println("")
+
+	printCountTable(ident, "Map", s.ByMap, w.top)
+	printCountTable(ident, "Game", s.ByGame, w.top)
+	printCountTable(ident, "OS", s.ByEnvironment, w.top)
+	printCountTable(ident, "VAC", s.ByVAC, w.top)
+	printCountTable(ident, "Version", s.ByVersion, w.top)
+
+	fill := make([][2]string, len(s.FillRate))
+	for i, bucket := range s.FillRate {
+		fill[i] = [2]string{bucket.Label, fmt.Sprint(bucket.Servers)}
+	}
+	printPairTable(ident, "Fill", fill)
+}
+
+// printCountTable prints counts largest first, folding everything past top
+// into a single "(others)" row when top is positive.
+func printCountTable(ident Ident, title string, counts map[string]int, top int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := make([][2]string, 0, len(keys))
+	others := 0
+
+	for i, key := range keys {
+		if top > 0 && i >= top {
+			others += counts[key]
+			continue
+		}
+		label := query.CleanText(key)
+		if label == "" {
+			label = "(none)"
+		}
+		rows = append(rows, [2]string{label, fmt.Sprint(counts[key])})
+	}
+
+	if others > 0 {
+		rows = append(rows, [2]string{fmt.Sprintf("(%d others)", len(keys)-top), fmt.Sprint(others)})
+	}
+
+	printPairTable(ident, title, rows)
+}
+
+// printPairTable prints rows in two aligned columns. Keys are measured in
+// display cells, so callers clean them of control characters first.
+func printPairTable(ident Ident, title string, rows [][2]string) {
+	keyWidth, countWidth := query.DisplayWidth(title), len("Servers")
+	for _, row := range rows {
+		if width := query.DisplayWidth(row[0]); width > keyWidth {
+			keyWidth = width
+		}
+		if len(row[1]) > countWidth {
+			countWidth = len(row[1])
+		}
+	}
+
+	ident.Printf(" %s | %s \n", padded(title, keyWidth), paddedR("Servers", countWidth))
+	ident.Printf("%s+%s\n", strings.Repeat("-", keyWidth+2), strings.Repeat("-", countWidth+2))
+	for _, row := range rows {
+		ident.Printf(" %s | %s \n", padded(row[0], keyWidth), paddedR(row[1], countWidth))
+	}
+	ident.Println("")
+}